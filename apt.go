@@ -1,8 +1,8 @@
 package reqs
 
 import (
+	"context"
 	"io/ioutil"
-	"os/exec"
 	"strings"
 )
 
@@ -22,10 +22,15 @@ func GetAptSources() (out string) {
 	return out
 }
 
-func AptListInstalled(withVersion bool) (reqs string) {
-	out, err := exec.Command("apt", "list", "--installed").Output()
+func AptListInstalled(ctx context.Context, withVersion bool) (reqs string) {
+	out, err := commandOutput(ctx, "apt", "list", "--installed")
 	FatalCheck(err)
-	for _, line := range strings.Split(string(out), "\n") {
+	return parseAptList(string(out), withVersion)
+}
+
+// parse the output of apt list --installed
+func parseAptList(out string, withVersion bool) (reqs string) {
+	for _, line := range strings.Split(out, "\n") {
 		if strings.Contains(line, "/") {
 			lSplit := strings.Split(string(line), "/")
 			req := lSplit[0]
@@ -0,0 +1,63 @@
+package reqs
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"path/filepath"
+)
+
+// installing the language package managers the pip, pip3 and npm steps
+// rely on through the system package tool
+
+// system packages providing each language step's command per package tool
+var languagePrerequisites = map[string]map[string]string{
+	"pip": {
+		"apt":  "python-pip",
+		"dnf":  "python2-pip",
+		"yum":  "python-pip",
+		"brew": "python@2",
+	},
+	"pip3": {
+		"apt":  "python3-pip",
+		"dnf":  "python3-pip",
+		"yum":  "python3-pip",
+		"brew": "python",
+	},
+	"npm": {
+		"apt":  "npm",
+		"dnf":  "npm",
+		"yum":  "npm",
+		"brew": "node",
+	},
+}
+
+// the system packages to install with pc.Tool before running command for
+// a pip, pip3 or npm step, none when command is already available
+func (pc PackageConfig) Prerequisites(step, command string) (found []Requirement) {
+	if IsCommandAvailable(command) {
+		return nil
+	}
+	pkg, ok := languagePrerequisites[step][emulatedTool(pc.Tool)]
+	if !ok {
+		log.Warn("Don't know which " + pc.Tool + " package provides " + command)
+		return nil
+	}
+	r := NewRequirement(pkg, pc.Tool)
+	r.Section = step
+	return []Requirement{r}
+}
+
+// install the system package providing command when it is missing
+func (pc PackageConfig) Bootstrap(ctx context.Context, step, command string) {
+	prereqs := pc.Prerequisites(step, command)
+	if len(prereqs) == 0 {
+		return
+	}
+	log.Info(command + " not found, installing " + RequirementsList(prereqs) + " with " + pc.Tool)
+	pc.Reqs = RequirementsList(prereqs)
+	pc.Install(ctx, false)
+	if !IsCommandAvailable(command) {
+		// a custom executable path is not provided by the system package
+		log.Fatal(command + " is still not available after installing " + pc.Reqs + ", check the path " + filepath.Clean(command))
+	}
+}
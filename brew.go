@@ -1,28 +1,107 @@
 package reqs
 
 import (
+	"context"
 	log "github.com/sirupsen/logrus"
-	"os/exec"
 	"strings"
 )
 
-func BrewListInstalled() string {
-	out, err := exec.Command("brew", "list").Output()
+func BrewListInstalled(ctx context.Context) string {
+	out, err := commandOutput(ctx, "brew", "list")
 	FatalCheck(err)
 	return strings.TrimSpace(string(out))
 }
 
-func InstallHomebrew() {
+func InstallHomebrew(ctx context.Context) {
 	log.Info("Installing homebrew")
-	cmd := exec.Command("/usr/bin/ruby",
-		"-e",
-		"\"$(curl -fsSL https://raw.githubusercontent.com/Homebrew/install/master/install)\"")
-	err := cmd.Run()
+	// fetch the installer first rather than substituting it into a shell
+	script, err := commandOutput(ctx, "curl", "-fsSL", "https://raw.githubusercontent.com/Homebrew/install/master/install")
+	FatalCheck(err)
+	_, err = commandOutput(ctx, "/usr/bin/ruby", "-e", string(script))
 	FatalCheck(err)
 }
 
-func GetBrewTaps() string {
-	out, err := exec.Command("brew", "tap").Output()
+func GetBrewTaps(ctx context.Context) string {
+	out, err := commandOutput(ctx, "brew", "tap")
 	FatalCheck(err)
 	return strings.TrimSpace(string(out))
 }
+
+// parse a Brewfile as used by `brew bundle` and return the brew formulae
+// in it newline separated, tap, cask and mas entries are skipped
+func ParseBrewfile(text string) (reqs string) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		name := brewfileEntryName(line)
+		switch fields[0] {
+		case "brew":
+			if name != "" {
+				reqs = NewLineIfNotEmpty(reqs, name)
+			}
+		case "cask", "tap", "mas":
+			log.Warn("Skipping Brewfile " + fields[0] + " entry " + name)
+		default:
+			log.Warn("Skipping unrecognized Brewfile line: " + line)
+		}
+	}
+	return reqs
+}
+
+// the name of a Brewfile entry is its first quoted argument
+func brewfileEntryName(line string) string {
+	start := strings.IndexAny(line, "\"'")
+	if start == -1 {
+		return ""
+	}
+	end := strings.IndexByte(line[start+1:], line[start])
+	if end == -1 {
+		return ""
+	}
+	return line[start+1 : start+1+end]
+}
+
+// build a Brewfile from the brew, common, taps and casks sections of
+// any reqs.yml files found in the directory
+func GetBrewfile(dirPath string, recurse bool) string {
+	return GetBrewfileMultipleDirs([]string{dirPath}, recurse)
+}
+
+func GetBrewfileMultipleDirs(dirPaths []string, recurse bool) (text string) {
+	// Brewfile keyword for each reqs.yml section, in output order
+	sections := [][2]string{
+		{"taps", "tap"},
+		{"common", "brew"},
+		{"brew", "brew"},
+		{"casks", "cask"},
+	}
+	var lines []string
+	for _, dirPath := range dirPaths {
+		for _, rf := range findRequirementsFiles(dirPath, recurse) {
+			if rf.Kind != KindReqsYml {
+				continue
+			}
+			log.Info("Found " + rf.Path)
+			conf := ymlToMap(rf.Path)
+			for _, section := range sections {
+				for _, p := range ymlPackages(conf[section[0]]) {
+					for _, name := range strings.Fields(p) {
+						lines = appendUnique(lines, section[1]+" \""+name+"\"")
+					}
+				}
+			}
+		}
+	}
+	// keep taps first and casks last regardless of which file they came from
+	for _, keyword := range []string{"tap", "brew", "cask"} {
+		for _, line := range lines {
+			if strings.HasPrefix(line, keyword+" ") {
+				text += line + "\n"
+			}
+		}
+	}
+	return text
+}
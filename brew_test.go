@@ -0,0 +1,31 @@
+package reqs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBrewfile(t *testing.T) {
+	brewfile := `# comment
+tap "homebrew/cask"
+brew "git"
+brew 'go', args: ["HEAD"]
+cask "firefox"
+mas "Xcode", id: 497799835
+`
+	assert.Equal(t, "git\ngo", ParseBrewfile(brewfile))
+}
+
+func TestGetBrewfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reqs-brewfile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	yml := "common:\n  - curl git\nbrew:\n  - go\ncasks:\n  - firefox\ntaps:\n  - homebrew/cask\napt:\n  - golang-go\n"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "reqs.yml"), []byte(yml), 0644))
+
+	expected := "tap \"homebrew/cask\"\nbrew \"curl\"\nbrew \"git\"\nbrew \"go\"\ncask \"firefox\"\n"
+	assert.Equal(t, expected, GetBrewfile(dir, false))
+}
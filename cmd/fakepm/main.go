@@ -0,0 +1,343 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/iepathos/reqs"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// fakepm is a package tool for end-to-end tests of reqs, it installs
+// nothing and records packages in a json state file instead
+//
+//  FAKEPM_STATE   path of the state file, fakepm.json beside the executable by default
+//  FAKEPM_FLAVOR  apt, dnf, yum or brew, the tool whose list output fakepm imitates
+//
+// The state file has the installed packages and, optionally, the packages
+// available to install with their versions.  When available is missing
+// every package is available at version 1.0.0.
+//
+//  {"available": {"git": "2.17.1"}, "installed": {"git": "2.17.1"}}
+//
+// Linked or copied as pip, pip3 or npm fakepm records their installs under
+// tools in the state file and lists them like pip freeze or npm ls --json,
+// and as sudo it runs the rest of its arguments, so a directory of hard
+// links stands in for every tool reqs runs.  pip and
+// npm run without FAKEPM_STATE in their environment, so they share the
+// default state file of the directory.
+
+type state struct {
+    Available map[string]string            `json:"available,omitempty"`
+    Installed map[string]string            `json:"installed"`
+    Tools     map[string]map[string]string `json:"tools,omitempty"`
+}
+
+const defaultVersion = "1.0.0"
+
+func statePath() string {
+    if path := os.Getenv("FAKEPM_STATE"); path != "" {
+        return path
+    }
+    exe, err := os.Executable()
+    if err != nil {
+        fail(1, err.Error())
+    }
+    return filepath.Join(filepath.Dir(exe), "fakepm.json")
+}
+
+func loadState() (st state) {
+    b, err := ioutil.ReadFile(statePath())
+    if err != nil && !os.IsNotExist(err) {
+        fail(1, err.Error())
+    }
+    if len(b) > 0 {
+        if err := json.Unmarshal(b, &st); err != nil {
+            fail(1, statePath()+": "+err.Error())
+        }
+    }
+    if st.Installed == nil {
+        st.Installed = make(map[string]string)
+    }
+    return st
+}
+
+func (st state) save() {
+    b, err := json.MarshalIndent(st, "", "  ")
+    if err != nil {
+        fail(1, err.Error())
+    }
+    if err := ioutil.WriteFile(statePath(), append(b, '\n'), 0644); err != nil {
+        fail(1, err.Error())
+    }
+}
+
+// the version name=version resolves to, ok is false for unknown packages
+func (st state) resolve(name, version string) (string, bool) {
+    if st.Available == nil {
+        if version == "" {
+            version = defaultVersion
+        }
+        return version, true
+    }
+    available, ok := st.Available[name]
+    if !ok || (version != "" && version != available) {
+        return "", false
+    }
+    return available, true
+}
+
+func fail(code int, msg string) {
+    fmt.Fprintln(os.Stderr, msg)
+    os.Exit(code)
+}
+
+// the package arguments, options like -y and --force are accepted and ignored
+func packageArgs(args []string) (pkgs []string) {
+    for _, arg := range args {
+        if !strings.HasPrefix(arg, "-") {
+            pkgs = append(pkgs, arg)
+        }
+    }
+    return pkgs
+}
+
+// like apt, nothing is installed when any package is unknown
+func install(st state, args []string) {
+    resolved := make(map[string]string)
+    var unknown []string
+    for _, spec := range packageArgs(args) {
+        name, version := spec, ""
+        if i := strings.Index(spec, "="); i > 0 {
+            name, version = spec[:i], spec[i+1:]
+        }
+        if err := reqs.ValidatePackageName(reqs.FakepmFlavor(), spec); err != nil {
+            unknown = append(unknown, "E: "+err.Error())
+            continue
+        }
+        v, ok := st.resolve(name, version)
+        if !ok {
+            unknown = append(unknown, "E: Unable to locate package "+spec)
+            continue
+        }
+        resolved[name] = v
+    }
+    if len(unknown) > 0 {
+        fail(100, strings.Join(unknown, "\n"))
+    }
+    for _, name := range sortedKeys(resolved) {
+        if st.Installed[name] == resolved[name] {
+            fmt.Println(name + " is already the newest version (" + resolved[name] + ").")
+            continue
+        }
+        st.Installed[name] = resolved[name]
+        fmt.Println("Setting up " + name + " (" + resolved[name] + ") ...")
+    }
+    st.save()
+}
+
+// exits 100 like apt-cache show when a package is unknown
+func show(st state, args []string) {
+    for _, name := range packageArgs(args) {
+        version, ok := st.resolve(name, "")
+        if !ok {
+            fail(100, "E: No packages found")
+        }
+        // every package is a 1MiB download
+        fmt.Println("Package: " + name + "\nVersion: " + version + "\nSize: 1048576")
+    }
+}
+
+func remove(st state, args []string) {
+    for _, name := range packageArgs(args) {
+        if _, ok := st.Installed[name]; !ok {
+            fmt.Println("Package '" + name + "' is not installed, so not removed")
+            continue
+        }
+        delete(st.Installed, name)
+        fmt.Println("Removing " + name + " ...")
+    }
+    st.save()
+}
+
+func list(st state) {
+    switch reqs.FakepmFlavor() {
+    case "brew":
+        for _, name := range sortedKeys(st.Installed) {
+            fmt.Println(name)
+        }
+        return
+    case "dnf", "yum":
+        fmt.Println("Installed Packages")
+        for _, name := range sortedKeys(st.Installed) {
+            fmt.Printf("%-30s %-20s @fakepm\n", name+".noarch", st.Installed[name])
+        }
+        return
+    }
+    fmt.Println("Listing... Done")
+    for _, name := range sortedKeys(st.Installed) {
+        fmt.Println(name + "/fakepm,now " + st.Installed[name] + " all [installed]")
+    }
+}
+
+func sortedKeys(m map[string]string) (keys []string) {
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// pip and npm install, uninstall and list their packages, pip with
+// freeze and npm with ls --json
+func runTool(st state, tool string, args []string) {
+    // the command is the first argument that isn't an option, npm -g install
+    command, rest := "", []string{}
+    for _, arg := range args {
+        if command == "" && !strings.HasPrefix(arg, "-") {
+            command = arg
+            continue
+        }
+        rest = append(rest, arg)
+    }
+    switch command {
+    case "install":
+        installTool(st, tool, rest)
+    case "uninstall":
+        for _, name := range packageArgs(rest) {
+            delete(st.Tools[tool], name)
+            fmt.Println("Successfully uninstalled " + name)
+        }
+        st.save()
+    case "freeze":
+        for _, name := range sortedKeys(st.Tools[tool]) {
+            fmt.Println(name + "==" + st.Tools[tool][name])
+        }
+    case "ls":
+        deps := make(map[string]map[string]string)
+        for name, version := range st.Tools[tool] {
+            deps[name] = map[string]string{"version": version}
+        }
+        b, _ := json.Marshal(map[string]interface{}{"dependencies": deps})
+        fmt.Println(string(b))
+    default:
+        fail(1, "usage: "+tool+" install|uninstall|freeze|ls [packages]")
+    }
+}
+
+// record pip install -r file or npm install name@version packages
+func installTool(st state, tool string, args []string) {
+    pkgs := make(map[string]string)
+    for i, arg := range args {
+        switch {
+        case arg == "-r" && i+1 < len(args):
+            readRequirementsFile(args[i+1], pkgs)
+        case i > 0 && args[i-1] == "-r", strings.HasPrefix(arg, "-"):
+            // the file read above and options
+        default:
+            pkgs[arg] = ""
+        }
+    }
+    if st.Tools == nil {
+        st.Tools = make(map[string]map[string]string)
+    }
+    if st.Tools[tool] == nil {
+        st.Tools[tool] = make(map[string]string)
+    }
+    for _, spec := range sortedKeys(pkgs) {
+        name, version := spec, defaultVersion
+        sep := strings.IndexAny(spec, "=<>!~")
+        if tool == "npm" {
+            sep = strings.LastIndex(spec, "@")
+        }
+        if sep > 0 {
+            name, version = spec[:sep], strings.TrimLeft(spec[sep:], "=<>!~@")
+        }
+        st.Tools[tool][name] = version
+        fmt.Println("Successfully installed " + name + "-" + version)
+    }
+    st.save()
+}
+
+// add the requirements of a pip requirements file to pkgs, following -r
+// lines relative to the file like pip does, other options, comments and
+// environment markers are accepted and ignored
+func readRequirementsFile(path string, pkgs map[string]string) {
+    b, err := ioutil.ReadFile(path)
+    if err != nil {
+        fail(1, err.Error())
+    }
+    for _, line := range strings.Split(string(b), "\n") {
+        if i := strings.IndexAny(line, ";#"); i >= 0 {
+            line = line[:i]
+        }
+        if i := strings.Index(line, " --"); i >= 0 {
+            line = line[:i]
+        }
+        fields := strings.Fields(line)
+        switch {
+        case len(fields) == 2 && fields[0] == "-r":
+            included := fields[1]
+            if !filepath.IsAbs(included) {
+                included = filepath.Join(filepath.Dir(path), included)
+            }
+            readRequirementsFile(included, pkgs)
+        case len(fields) > 0 && !strings.HasPrefix(fields[0], "-"):
+            pkgs[strings.Join(fields, "")] = ""
+        }
+    }
+}
+
+// run the rest of the arguments like sudo would, as the current user,
+// there's no password so -v always succeeds
+func sudo(args []string) {
+    if len(args) == 1 && args[0] == "-v" {
+        return
+    }
+    if len(args) == 0 {
+        fail(1, "usage: sudo command [args]")
+    }
+    cmd := exec.Command(args[0], args[1:]...)
+    cmd.Stdin = os.Stdin
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    if err := cmd.Run(); err != nil {
+        if exitErr, ok := err.(*exec.ExitError); ok {
+            os.Exit(exitErr.ExitCode())
+        }
+        fail(1, err.Error())
+    }
+}
+
+func main() {
+    switch name := filepath.Base(os.Args[0]); name {
+    case "sudo":
+        sudo(os.Args[1:])
+        return
+    case "pip", "pip3", "npm":
+        runTool(loadState(), name, os.Args[1:])
+        return
+    }
+    if len(os.Args) < 2 {
+        fail(1, "usage: fakepm install|remove|show|update|upgrade|list installed [packages]")
+    }
+    st := loadState()
+    switch os.Args[1] {
+    case "install":
+        install(st, os.Args[2:])
+    case "remove":
+        remove(st, os.Args[2:])
+    case "show":
+        show(st, os.Args[2:])
+    case "update", "upgrade":
+        fmt.Println("Reading package lists... Done")
+    case "list":
+        list(st)
+    default:
+        fail(1, "fakepm: unknown command "+os.Args[1])
+    }
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "github.com/iepathos/reqs"
+    log "github.com/sirupsen/logrus"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// install the system requirements followed by the pip, pip3 and npm
+// requirements, each step within -step-timeout
+func runInstall(ctx context.Context, o *options) {
+    rp := o.parser()
+    structured := o.structured()
+    quiet := o.Quiet || structured
+    s := o.installSteps(rp)
+    // install results are reported at the end for json and yaml output
+    var results []reqs.Requirement
+    var planned []reqs.Requirement
+
+    sudo, packageTool, autoYes := rp.Tooling(ctx)
+    pc := reqs.PackageConfig{
+        Tool:        packageTool,
+        Sudo:        sudo,
+        AutoYes:     autoYes,
+        Force:       o.Force,
+        Quiet:       quiet,
+        LockTimeout: o.LockTimeout,
+    }
+
+    // everything to install is found up front to check it against the
+    // policies before anything runs
+    var sysFound []reqs.Requirement
+    if s.system {
+        sysFound = rp.SystemRequirements(packageTool)
+    }
+    var pipFound, pip3Found, npmFound []reqs.Requirement
+    if s.pip {
+        pipFound = rp.ToolRequirements("pip")
+        if len(pipFound) == 0 {
+            log.Warn("No pip requirements found")
+        }
+    }
+    if s.pip3 {
+        pip3Found = rp.ToolRequirements("pip3")
+        if len(pip3Found) == 0 {
+            log.Warn("No pip3 requirements found")
+        }
+    }
+    // npm install runs in each of these, the dependencies in their
+    // package.json files are checked with the rest
+    var packageDirs []string
+    var packageFound []reqs.Requirement
+    if s.npm {
+        npmFound = rp.ToolRequirements("npm")
+        if len(npmFound) == 0 {
+            log.Warn("No npm requirements found")
+        }
+        packageDirs = rp.FindNpmPackageDirs()
+        for _, pkgDir := range packageDirs {
+            found, err := reqs.PackageJSONRequirements(pkgDir)
+            reqs.FatalCheck(err)
+            packageFound = append(packageFound, found...)
+        }
+    }
+    pipRequirements := reqs.RequirementLines(pipFound)
+    pip3Requirements := reqs.RequirementLines(pip3Found)
+    npmRequirements := reqs.RequirementsList(npmFound)
+
+    // pip, pip3 and npm come from system packages when missing, those
+    // are checked and planned with the rest
+    prereqs := func(step, command string, needed bool) []reqs.Requirement {
+        if !needed {
+            return nil
+        }
+        return pc.Prerequisites(step, command)
+    }
+    var bootstrap []reqs.Requirement
+    bootstrap = append(bootstrap, prereqs("pip", o.pipPath("pip"), len(pipFound) > 0)...)
+    bootstrap = append(bootstrap, prereqs("pip3", o.pipPath("pip3"), len(pip3Found) > 0)...)
+    bootstrap = append(bootstrap, prereqs("npm", "npm", len(npmFound) > 0 || len(packageDirs) > 0)...)
+
+    all := append([]reqs.Requirement{}, sysFound...)
+    all = append(all, bootstrap...)
+    all = append(all, pipFound...)
+    all = append(all, pip3Found...)
+    all = append(all, npmFound...)
+    o.enforcePolicies(append(all, packageFound...))
+
+    var found, unresolved []reqs.Requirement
+    if s.system {
+        stepCtx, cancel := o.step(ctx)
+        found, unresolved = pc.Resolve(stepCtx, sysFound)
+        planned = append(planned, found...)
+        cancel()
+    }
+
+    // every install is recorded in the history
+    tx := &reqs.Transaction{Time: time.Now(), Tool: packageTool}
+    tools := o.historyTools(packageTool, s)
+    var before reqs.Snapshot
+    historyStart := 0
+    if !o.Plan {
+        // asked before taking the lock, a run waiting on an answer
+        // mustn't hold up other runs
+        if !o.Yes && !structured && reqs.IsTerminal(os.Stdin) {
+            plan := reqs.Plan{
+                Requirements: append(append(append(append(append([]reqs.Requirement{}, found...), bootstrap...), pipFound...), pip3Found...), npmFound...),
+                PackageDirs:  packageDirs,
+                Installed:    snapshot(ctx, tools),
+                Estimate: func(p reqs.Plan) (int64, bool) {
+                    return pc.DownloadSize(ctx, p.NewPackages(packageTool))
+                },
+            }
+            kept, ok, err := reqs.Confirm(os.Stdin, os.Stderr, plan)
+            reqs.FatalCheck(err)
+            if !ok {
+                log.Fatal("Aborted, nothing was installed")
+            }
+            split := byTool(kept.Requirements, packageTool, "pip", "pip3", "npm")
+            pipFound, pip3Found, npmFound = split[1], split[2], split[3]
+            packageDirs = kept.PackageDirs
+            var keptBootstrap []reqs.Requirement
+            found, keptBootstrap = splitBootstrap(split[0])
+            // a step can't run without the package its command comes from
+            for _, r := range bootstrap {
+                if len(inSection(keptBootstrap, r.Section)) > 0 {
+                    continue
+                }
+                log.Warn("Skipping the " + r.Section + " requirements, " + r.Name + " was left out")
+                switch r.Section {
+                case "pip":
+                    pipFound = nil
+                case "pip3":
+                    pip3Found = nil
+                case "npm":
+                    npmFound, packageDirs = nil, nil
+                }
+            }
+            planned = found
+            pipRequirements = reqs.RequirementLines(pipFound)
+            pip3Requirements = reqs.RequirementLines(pip3Found)
+            npmRequirements = reqs.RequirementsList(npmFound)
+        }
+        // one install at a time per host
+        lock, err := reqs.AcquireRunLock(ctx, reqs.DefaultLockPath, o.LockTimeout)
+        reqs.FatalCheck(err)
+        defer lock.Release()
+        ctx = reqs.WithTransaction(ctx, tx)
+        before = snapshot(ctx, tools)
+        historyStart = pc.ToolHistoryID(ctx)
+        if sudo != "" || o.SudoPip || o.SudoPip3 || o.SudoNpm {
+            reqs.FatalCheck(reqs.SudoValidate(ctx))
+        }
+    }
+
+    if s.system {
+        stepCtx, cancel := o.step(ctx)
+        if !o.Plan {
+            pc.Reqs = reqs.RequirementsList(found)
+            if o.Update || o.Upgrade {
+                pc.Update(stepCtx)
+            }
+            if o.Upgrade {
+                pc.Upgrade(stepCtx)
+            }
+            var failures []reqs.InstallFailure
+            if len(found) > 0 {
+                failures = pc.Install(stepCtx, o.Upgrade)
+            }
+            results = append(results, reqs.WithFailures(found, failures)...)
+            results = append(results, unresolved...)
+        }
+        cancel()
+    }
+
+    if o.Plan {
+        planned = append(planned, bootstrap...)
+        planned = append(planned, pipFound...)
+        planned = append(planned, pip3Found...)
+        planned = append(planned, npmFound...)
+        reqs.FatalCheck(reqs.PrintRequirements(os.Stdout, o.Format, reqs.WithStatus(planned, reqs.StatusPlanned)))
+        return
+    }
+
+    if pipRequirements != "" {
+        stepCtx, cancel := o.step(ctx)
+        pc.Bootstrap(stepCtx, "pip", o.pipPath("pip"))
+        reqs.PipInstall(stepCtx, pipRequirements, o.pipPath("pip"), o.SudoPip, o.Upgrade, quiet)
+        results = append(results, reqs.WithStatus(pipFound, reqs.StatusInstalled)...)
+        cancel()
+    }
+    if pip3Requirements != "" {
+        stepCtx, cancel := o.step(ctx)
+        pc.Bootstrap(stepCtx, "pip3", o.pipPath("pip3"))
+        reqs.PipInstall(stepCtx, pip3Requirements, o.pipPath("pip3"), o.SudoPip3, o.Upgrade, quiet)
+        results = append(results, reqs.WithStatus(pip3Found, reqs.StatusInstalled)...)
+        cancel()
+    }
+    if s.npm {
+        stepCtx, cancel := o.step(ctx)
+        if npmRequirements != "" || len(packageDirs) > 0 {
+            pc.Bootstrap(stepCtx, "npm", "npm")
+        }
+        if npmRequirements != "" {
+            globalArg := true
+            fromDirectory := ""
+            // install global npm requirements
+            reqs.NpmInstall(stepCtx, npmRequirements, fromDirectory, o.SudoNpm, globalArg, quiet)
+            results = append(results, reqs.WithStatus(npmFound, reqs.StatusInstalled)...)
+        }
+        // any directories with package.json in them but where
+        // node_modules is not part of the path run just `npm install` inside
+        for _, pkgDir := range packageDirs {
+            reqs.NpmInstall(stepCtx, "", pkgDir, false, false, quiet)
+        }
+        cancel()
+    }
+
+    tx.Sources = sources(planned)
+    recordTransaction(ctx, tx, pc, historyStart, before, tools)
+    if structured {
+        reqs.FatalCheck(reqs.PrintRequirements(os.Stdout, o.Format, results))
+    }
+    reportFailures(o, results)
+}
+
+// the requirements of each of tools, in the order of tools
+func byTool(found []reqs.Requirement, tools ...string) [][]reqs.Requirement {
+    split := make([][]reqs.Requirement, len(tools))
+    for _, r := range found {
+        for i, tool := range tools {
+            if r.Tool == tool {
+                split[i] = append(split[i], r)
+            }
+        }
+    }
+    return split
+}
+
+// the system packages pip, pip3 and npm come from, told apart from the
+// system requirements by their step's section and having no file
+func splitBootstrap(found []reqs.Requirement) (sys, bootstrap []reqs.Requirement) {
+    for _, r := range found {
+        if r.Source == "" && (r.Section == "pip" || r.Section == "pip3" || r.Section == "npm") {
+            bootstrap = append(bootstrap, r)
+        } else {
+            sys = append(sys, r)
+        }
+    }
+    return sys, bootstrap
+}
+
+// the requirements of found in section
+func inSection(found []reqs.Requirement, section string) (in []reqs.Requirement) {
+    for _, r := range found {
+        if r.Section == section {
+            in = append(in, r)
+        }
+    }
+    return in
+}
+
+// exit 1 with a report of every violation of the system policy and
+// -policy
+func (o *options) enforcePolicies(found []reqs.Requirement) {
+    policies, err := reqs.LoadPolicies(reqs.DefaultPolicyPath, o.Policy)
+    reqs.FatalCheck(err)
+    violations := reqs.CheckPolicies(policies, found)
+    if len(violations) == 0 {
+        return
+    }
+    for _, v := range violations {
+        log.Error(v)
+    }
+    log.Fatal(strconv.Itoa(len(violations)) + " requirements violate the policy, nothing was installed")
+}
+
+// the files found requirements came from
+func sources(found []reqs.Requirement) (files []string) {
+    seen := make(map[string]bool)
+    for _, r := range found {
+        if r.Source != "" && !seen[r.Source] {
+            seen[r.Source] = true
+            files = append(files, r.Source)
+        }
+    }
+    return files
+}
+
+// log each package that failed to install with the tool's reason, a
+// failure exits 1 unless only optional packages failed and -keep-going
+func reportFailures(o *options, results []reqs.Requirement) {
+    var failed []reqs.Requirement
+    required := 0
+    for _, r := range results {
+        if r.Status == reqs.StatusFailed {
+            failed = append(failed, r)
+            if !r.Optional {
+                required++
+            }
+        }
+    }
+    if len(failed) == 0 {
+        return
+    }
+    report := log.Error
+    if required == 0 && o.KeepGoing {
+        report = log.Warn
+    }
+    report(fmt.Sprintf("Failed to install %d of %d packages:", len(failed), len(results)))
+    for _, r := range failed {
+        msg := "  " + r.Spec() + ": " + r.Error
+        if r.Optional {
+            msg += " (optional)"
+        }
+        report(msg)
+    }
+    if required > 0 || !o.KeepGoing {
+        os.Exit(1)
+    }
+}
+
+// list the installed system packages
+func runList(ctx context.Context, o *options) {
+    rp := o.parser()
+    if o.Yml && !o.structured() {
+        reqs.StdoutReqsYml(rp.GenerateReqsYml(ctx))
+        return
+    }
+    reqs.FatalCheck(reqs.PrintRequirements(os.Stdout, o.Format, rp.GenerateRequirements(ctx)))
+}
+
+// list the apt sources or brew taps
+func runSources(ctx context.Context, o *options) {
+    rp := o.parser()
+    _, packageTool, _ := rp.Tooling(ctx)
+    reqs.FatalCheck(rp.WriteSources(ctx, os.Stdout, packageTool))
+}
+
+// report the system requirements that are not installed
+func runCheck(ctx context.Context, o *options) {
+    rp := o.parser()
+    _, packageTool, _, found := rp.Plan(ctx)
+    checked, missing := rp.Check(ctx, packageTool, found)
+    if o.structured() {
+        reqs.FatalCheck(reqs.PrintRequirements(os.Stdout, o.Format, checked))
+    } else {
+        for _, r := range checked {
+            if r.Status == reqs.StatusMissing {
+                fmt.Println(r.Spec())
+            }
+        }
+    }
+    if missing > 0 {
+        os.Exit(1)
+    }
+}
+
+// trace a package through the requirements files, exits 1 when none
+// of them name it
+func runExplain(ctx context.Context, o *options, name string) {
+    rp := o.parser()
+    _, packageTool, _ := rp.Tooling(ctx)
+    installed := reqs.Snapshot{}
+    for _, t := range o.historyTools(packageTool, steps{pip: true, pip3: true, npm: true}) {
+        err := installed.Add(ctx, t.tool, t.command, t.sudo)
+        if _, ok := err.(*reqs.InterruptedError); ok {
+            reqs.FatalCheck(err)
+        }
+        if err != nil {
+            log.Warn("Can't tell which " + t.tool + " packages are installed: " + err.Error())
+        }
+    }
+    refs := rp.Explain(name, packageTool, installed)
+    reqs.FatalCheck(reqs.PrintReferences(os.Stdout, o.Format, refs))
+    if len(refs) == 0 {
+        log.Fatal("No requirements file names " + name)
+    }
+}
+
+// write the requirements in another tool's format
+func runExport(o *options, format string) {
+    switch format {
+    case "brewfile":
+        fmt.Print(o.parser().ExportBrewfile())
+    default:
+        log.Fatal("Unsupported export format '" + format + "', expected brewfile")
+    }
+}
+
+// lint the given files, or the requirements files found
+func runLint(o *options, files []string) {
+    var diags []reqs.Diagnostic
+    if len(files) > 0 {
+        for _, fname := range files {
+            diags = append(diags, reqs.LintFile(fname)...)
+        }
+    } else {
+        diags = o.parser().Lint()
+    }
+    for _, d := range diags {
+        fmt.Println(d)
+    }
+    if reqs.HasErrors(diags) {
+        os.Exit(1)
+    }
+}
+
+// sign the given files, or the requirements files found
+func runSign(o *options, files []string) {
+    key, generated, err := reqs.LoadOrGenerateKey(o.Key)
+    reqs.FatalCheck(err)
+    if generated {
+        log.Info("Generated key " + key.Public().IDString() + " in " + o.Key + ", trust it by copying " + reqs.PublicKeyPath(o.Key) + " into the -trusted-keys directory")
+    }
+    if len(files) == 0 && o.File != "" {
+        files = []string{o.File}
+    }
+    // files named on their own are signed for installs from the working
+    // directory, found files for installs of the directory they're in
+    roots := make(map[string]string)
+    if len(files) == 0 {
+        dirs := "."
+        if o.Dir != "" {
+            dirs = o.Dir
+        }
+        for _, dir := range strings.Split(dirs, ",") {
+            found, err := reqs.DefaultDiscovery.FilesToSign(dir, o.Recurse)
+            reqs.FatalCheck(err)
+            for _, fname := range found {
+                roots[fname] = dir
+            }
+            files = append(files, found...)
+        }
+    }
+    if len(files) == 0 {
+        log.Fatal("No requirements files to sign")
+    }
+    for _, fname := range files {
+        root, ok := roots[fname]
+        if !ok {
+            root = "."
+        }
+        reqs.FatalCheck(reqs.SignFile(key, root, fname))
+        log.Info("Signed " + fname + " with key " + key.Public().IDString())
+    }
+}
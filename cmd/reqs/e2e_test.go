@@ -0,0 +1,442 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "github.com/iepathos/reqs"
+    "github.com/stretchr/testify/assert"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// end-to-end tests running the reqs binary over the example projects,
+// installing with fakepm so they need no VM, root or network
+
+var binDir string
+
+func TestMain(m *testing.M) {
+    dir, err := ioutil.TempDir("", "reqs-e2e-")
+    if err != nil {
+        panic(err)
+    }
+    build := exec.Command("go", "build", "-o", dir, "github.com/iepathos/reqs/cmd/reqs", "github.com/iepathos/reqs/cmd/fakepm")
+    build.Stderr = os.Stderr
+    if err := build.Run(); err != nil {
+        panic(err)
+    }
+    binDir = dir
+    code := m.Run()
+    os.RemoveAll(dir)
+    os.Exit(code)
+}
+
+type fakepmState struct {
+    Available map[string]string `json:"available,omitempty"`
+    Installed map[string]string `json:"installed"`
+}
+
+// a fakepm state file in a temp dir, seeded with st
+func newState(t *testing.T, st fakepmState) string {
+    path := filepath.Join(t.TempDir(), "fakepm.json")
+    b, err := json.Marshal(st)
+    assert.Nil(t, err)
+    assert.Nil(t, ioutil.WriteFile(path, b, 0644))
+    return path
+}
+
+func readState(t *testing.T, path string) (st fakepmState) {
+    b, err := ioutil.ReadFile(path)
+    assert.Nil(t, err)
+    assert.Nil(t, json.Unmarshal(b, &st))
+    return st
+}
+
+// run reqs with fakepm on the path, returns stdout and the exit code,
+// the history, keys and caches are kept beside the state file
+func runReqs(t *testing.T, statePath, flavor string, args ...string) (string, int) {
+    stdout, _, code := runReqsStderr(t, statePath, flavor, args...)
+    return stdout, code
+}
+
+// runReqs, also returning what reqs logged
+func runReqsStderr(t *testing.T, statePath, flavor string, args ...string) (string, string, int) {
+    return runReqsEnv(t, append(fakepmEnv(statePath, flavor), "REQS_FAKE_PM=1"), args...)
+}
+
+// the environment fakepm and reqs run with, reqs only installs with
+// fakepm when REQS_FAKE_PM is added or -tool fakepm is given
+func fakepmEnv(statePath, flavor string) []string {
+    return append(os.Environ(),
+        "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+        "FAKEPM_STATE="+statePath,
+        "FAKEPM_FLAVOR="+flavor,
+        "XDG_STATE_HOME="+filepath.Dir(statePath),
+        "XDG_CONFIG_HOME="+filepath.Dir(statePath),
+        "XDG_CACHE_HOME="+filepath.Dir(statePath),
+    )
+}
+
+func runReqsEnv(t *testing.T, env []string, args ...string) (string, string, int) {
+    cmd := exec.Command(filepath.Join(binDir, "reqs"), args...)
+    cmd.Env = env
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+    err := cmd.Run()
+    code := 0
+    if exitErr, ok := err.(*exec.ExitError); ok {
+        code = exitErr.ExitCode()
+    } else {
+        assert.Nil(t, err)
+    }
+    if code != 0 {
+        t.Log(stderr.String())
+    }
+    return stdout.String(), stderr.String(), code
+}
+
+func exampleDir(name string) string {
+    return filepath.Join("..", "..", "examples", name)
+}
+
+func TestE2EToolFlagSelectsFakepm(t *testing.T) {
+    state := newState(t, fakepmState{})
+    _, _, code := runReqsEnv(t, fakepmEnv(state, "apt"), "install", "-only", "system", "-tool", "fakepm", "-d", exampleDir("dev-machine2"))
+    assert.Equal(t, 0, code)
+    assert.Contains(t, readState(t, state).Installed, "git")
+}
+
+func TestE2EInstallExamples(t *testing.T) {
+    examples := map[string][]string{
+        "dev-machine":   {"git", "zsh", "golang-go"},
+        "dev-machine2":  {"git"},
+        "flask-service": {"python", "python-pip"},
+        "pip3-setup":    {"python3", "python3-pip"},
+        "data-service":  {"python-pip", "gfortran"},
+        "web-service":   {"npm"},
+    }
+    for example, want := range examples {
+        t.Run(example, func(t *testing.T) {
+            state := newState(t, fakepmState{})
+            _, code := runReqs(t, state, "apt", "install", "-only", "system", "-d", exampleDir(example))
+            assert.Equal(t, 0, code)
+            installed := readState(t, state).Installed
+            for _, name := range want {
+                assert.Contains(t, installed, name)
+            }
+
+            out, code := runReqs(t, state, "apt", "check", "-d", exampleDir(example))
+            assert.Equal(t, 0, code)
+            assert.Empty(t, out)
+        })
+    }
+}
+
+func TestE2EDnfFlavor(t *testing.T) {
+    state := newState(t, fakepmState{})
+    _, code := runReqs(t, state, "dnf", "install", "-only", "system", "-d", exampleDir("dev-machine"))
+    assert.Equal(t, 0, code)
+    installed := readState(t, state).Installed
+    assert.Contains(t, installed, "golang")
+    assert.NotContains(t, installed, "golang-go")
+
+    out, code := runReqs(t, state, "dnf", "list")
+    assert.Equal(t, 0, code)
+    assert.Contains(t, strings.Fields(out), "golang.noarch")
+
+    _, code = runReqs(t, state, "dnf", "check", "-d", exampleDir("dev-machine"))
+    assert.Equal(t, 0, code)
+}
+
+// -tool picks the section of a plain list, not the tool fakepm emulates
+func TestE2EInputTool(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "packages.txt")
+    assert.Nil(t, ioutil.WriteFile(path, []byte("git\n"), 0644))
+
+    state := newState(t, fakepmState{})
+    _, code := runReqs(t, state, "apt", "install", "-only", "system", "-tool", "brew", "-f", path)
+    assert.Equal(t, 0, code)
+    assert.Empty(t, readState(t, state).Installed)
+
+    _, code = runReqs(t, state, "apt", "install", "-only", "system", "-tool", "common", "-f", path)
+    assert.Equal(t, 0, code)
+    assert.Contains(t, readState(t, state).Installed, "git")
+}
+
+// the flags from before commands still work, warning about their
+// replacement
+func TestE2EDeprecatedFlags(t *testing.T) {
+    state := newState(t, fakepmState{Installed: map[string]string{"git": "2.17.1"}})
+    cases := map[string]struct {
+        replacement string
+        want        string
+    }{
+        "-o":   {"reqs list", "git\n"},
+        "-ov":  {"reqs list -versions", "git=2.17.1\n"},
+        "-yml": {"reqs list -yml", "git"},
+        "-so":  {"reqs sources", ""},
+    }
+    for flag, c := range cases {
+        t.Run(flag, func(t *testing.T) {
+            out, stderr, code := runReqsStderr(t, state, "apt", flag)
+            assert.Equal(t, 0, code)
+            assert.Contains(t, out, c.want)
+            assert.Contains(t, stderr, flag+" is deprecated and will be removed in the next release, use "+c.replacement)
+        })
+    }
+}
+
+func TestE2ECheckMissing(t *testing.T) {
+    state := newState(t, fakepmState{Installed: map[string]string{"python": "2.7.15"}})
+    out, code := runReqs(t, state, "apt", "check", "-d", exampleDir("flask-service"))
+    assert.Equal(t, 1, code)
+    assert.Equal(t, "python-pip\n", out)
+}
+
+// the installable packages still go in when one is unknown
+func TestE2EUnknownPackage(t *testing.T) {
+    available := map[string]string{"python": "2.7.15", "git": "2.17.1", "curl": "7.58.0"}
+    state := newState(t, fakepmState{Available: available})
+    _, code := runReqs(t, state, "apt", "install", "-only", "system", "-d", exampleDir("flask-service"))
+    assert.Equal(t, 1, code)
+    assert.Equal(t, map[string]string{"python": "2.7.15"}, readState(t, state).Installed)
+
+    state = newState(t, fakepmState{Available: available})
+    // -keep-going only forgives optional packages
+    out, code := runReqs(t, state, "apt", "install", "-only", "system", "-keep-going", "-format", "json", "-d", exampleDir("flask-service"))
+    assert.Equal(t, 1, code)
+    var results []map[string]interface{}
+    assert.Nil(t, json.Unmarshal([]byte(out), &results))
+    assert.Len(t, results, 2)
+    for _, r := range results {
+        if r["package"] == "python-pip" {
+            assert.Equal(t, "failed", r["status"])
+            assert.Equal(t, "E: Unable to locate package python-pip", r["error"])
+        } else {
+            assert.Equal(t, "installed", r["status"])
+        }
+    }
+}
+
+func TestE2EOptionalAndAnyOf(t *testing.T) {
+    dir := t.TempDir()
+    yml := "apt:\n  - python\n  - optional: htop\n  - optional: ripgrep\n  - any-of: [fd-find, fd]\n"
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "reqs.yml"), []byte(yml), 0644))
+    available := map[string]string{"python": "2.7.15", "ripgrep": "0.10.0", "fd": "7.1.0"}
+
+    state := newState(t, fakepmState{Available: available})
+    _, code := runReqs(t, state, "apt", "install", "-d", dir)
+    assert.Equal(t, 0, code)
+    assert.Equal(t, available, readState(t, state).Installed)
+
+    out, code := runReqs(t, state, "apt", "check", "-d", dir)
+    assert.Equal(t, 0, code)
+    assert.Equal(t, "htop\n", out)
+
+    // no alternative available fails the install
+    state = newState(t, fakepmState{Available: map[string]string{"python": "2.7.15"}})
+    _, code = runReqs(t, state, "apt", "install", "-d", dir)
+    assert.Equal(t, 1, code)
+    assert.Equal(t, map[string]string{"python": "2.7.15"}, readState(t, state).Installed)
+}
+
+func TestE2EPlan(t *testing.T) {
+    state := newState(t, fakepmState{})
+    out, code := runReqs(t, state, "apt", "install", "-only", "system", "-plan", "-format", "json", "-d", exampleDir("flask-service"))
+    assert.Equal(t, 0, code)
+    var planned []map[string]interface{}
+    assert.Nil(t, json.Unmarshal([]byte(out), &planned))
+    assert.Len(t, planned, 2)
+    assert.Equal(t, "fakepm", planned[0]["tool"])
+    assert.Empty(t, readState(t, state).Installed)
+}
+
+func TestE2ETimeout(t *testing.T) {
+    state := newState(t, fakepmState{})
+    _, code := runReqs(t, state, "apt", "install", "-only", "system", "-timeout", "1ns", "-d", exampleDir("dev-machine"))
+    assert.Equal(t, 124, code)
+    assert.Empty(t, readState(t, state).Installed)
+}
+
+func TestE2EHistoryRollback(t *testing.T) {
+    state := newState(t, fakepmState{Installed: map[string]string{"git": "0.9"}})
+    _, code := runReqs(t, state, "apt", "install", "-only", "system", "-d", exampleDir("dev-machine2"))
+    assert.Equal(t, 0, code)
+    assert.Equal(t, "1.0.0", readState(t, state).Installed["git"])
+
+    out, code := runReqs(t, state, "apt", "history", "-format", "json")
+    assert.Equal(t, 0, code)
+    var history []reqs.Transaction
+    assert.Nil(t, json.Unmarshal([]byte(out), &history))
+    assert.Len(t, history, 1)
+    assert.Contains(t, history[0].Changes, reqs.PackageChange{Tool: "fakepm", Name: "git", Before: "0.9", After: "1.0.0"})
+    assert.Contains(t, history[0].Changes, reqs.PackageChange{Tool: "fakepm", Name: "zsh", After: "1.0.0", Installed: true})
+
+    _, code = runReqs(t, state, "apt", "rollback", "1")
+    assert.Equal(t, 0, code)
+    assert.Equal(t, map[string]string{"git": "0.9"}, readState(t, state).Installed)
+
+    out, _ = runReqs(t, state, "apt", "history")
+    assert.Contains(t, out, "rollback of 1")
+    _, code = runReqs(t, state, "apt", "rollback", "1")
+    assert.Equal(t, 1, code)
+}
+
+func TestE2ERequireSigned(t *testing.T) {
+    state := newState(t, fakepmState{Installed: map[string]string{}})
+    dir := t.TempDir()
+    yml := filepath.Join(dir, "reqs.yml")
+    assert.Nil(t, ioutil.WriteFile(yml, []byte("include:\n  - apt-requirements.txt\ncommon:\n  - git\n"), 0644))
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "apt-requirements.txt"), []byte("curl\n"), 0644))
+    key := filepath.Join(t.TempDir(), "reqs.key")
+    trusted := t.TempDir()
+    install := []string{"install", "-only", "system", "-d", dir, "-require-signed", "-trusted-keys", trusted}
+
+    _, code := runReqs(t, state, "apt", "sign", "-key", key, "-d", dir)
+    assert.Equal(t, 0, code)
+    assert.FileExists(t, yml+reqs.SignatureSuffix)
+    assert.FileExists(t, filepath.Join(dir, "apt-requirements.txt"+reqs.SignatureSuffix))
+
+    // signed by a key that isn't trusted yet
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(trusted, "other.pub"), []byte("untrusted comment: other\nRWQBAgMEBQYHCAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\n"), 0644))
+    _, code = runReqs(t, state, "apt", install...)
+    assert.Equal(t, 1, code)
+    assert.Empty(t, readState(t, state).Installed)
+
+    pub, err := ioutil.ReadFile(reqs.PublicKeyPath(key))
+    assert.Nil(t, err)
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(trusted, "reqs.pub"), pub, 0644))
+    _, code = runReqs(t, state, "apt", install...)
+    assert.Equal(t, 0, code)
+    assert.Contains(t, readState(t, state).Installed, "curl")
+
+    // an included file changed after signing
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "apt-requirements.txt"), []byte("curl\nnetcat\n"), 0644))
+    _, code = runReqs(t, state, "apt", install...)
+    assert.Equal(t, 1, code)
+    assert.NotContains(t, readState(t, state).Installed, "netcat")
+
+    // npm install would read an unsigned package.json
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "apt-requirements.txt"), []byte("curl\n"), 0644))
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "package.json"), []byte("{}\n"), 0644))
+    out, code := runReqs(t, state, "apt", "install", "-only", "npm", "-d", dir, "-require-signed", "-trusted-keys", trusted)
+    assert.Equal(t, 1, code)
+    assert.Empty(t, out)
+
+    // a signature made for another directory
+    sub := filepath.Join(dir, "sub")
+    assert.Nil(t, os.Mkdir(sub, 0755))
+    assert.Nil(t, os.Remove(filepath.Join(dir, "package.json")))
+    for _, name := range []string{"apt-requirements.txt", "apt-requirements.txt" + reqs.SignatureSuffix} {
+        b, err := ioutil.ReadFile(filepath.Join(dir, name))
+        assert.Nil(t, err)
+        assert.Nil(t, ioutil.WriteFile(filepath.Join(sub, name), b, 0644))
+    }
+    _, code = runReqs(t, state, "apt", "install", "-only", "system", "-d", dir, "-r", "-require-signed", "-trusted-keys", trusted)
+    assert.Equal(t, 1, code)
+}
+
+func TestE2EPolicy(t *testing.T) {
+    state := newState(t, fakepmState{Installed: map[string]string{}})
+    policy := filepath.Join(t.TempDir(), "policy.yml")
+    assert.Nil(t, ioutil.WriteFile(policy, []byte("deny:\n  all: [zsh]\n"), 0644))
+
+    _, code := runReqs(t, state, "apt", "install", "-only", "system", "-d", exampleDir("dev-machine2"), "-policy", policy)
+    assert.Equal(t, 1, code)
+    assert.Empty(t, readState(t, state).Installed)
+
+    _, code = runReqs(t, state, "apt", "install", "-only", "system", "-d", exampleDir("dev-machine2"), "-plan", "-policy", policy)
+    assert.Equal(t, 1, code)
+}
+
+func TestE2EPolicyBootstrap(t *testing.T) {
+    // pip3 is missing, so python3-pip would be installed before it runs
+    dir := t.TempDir()
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "reqs.yml"), []byte("pip3:\n  - flask\n"), 0644))
+    policy := filepath.Join(t.TempDir(), "policy.yml")
+    assert.Nil(t, ioutil.WriteFile(policy, []byte("deny:\n  apt: [python3-pip]\n"), 0644))
+    state := newState(t, fakepmState{Installed: map[string]string{}})
+
+    _, stderr, code := runReqsStderr(t, state, "apt", "install", "-only", "pip3", "-pip3", filepath.Join(dir, "missing", "pip3"), "-d", dir, "-policy", policy)
+    assert.Equal(t, 1, code)
+    assert.Contains(t, stderr, "python3-pip is denied as python3-pip")
+    assert.Empty(t, readState(t, state).Installed)
+}
+
+func TestE2EExplain(t *testing.T) {
+    state := newState(t, fakepmState{Installed: map[string]string{"python": "2.7.15"}})
+    out, code := runReqs(t, state, "dnf", "explain", "-format", "json", "-d", exampleDir("flask-service"), "python")
+    assert.Equal(t, 0, code)
+    var refs []reqs.Reference
+    assert.Nil(t, json.Unmarshal([]byte(out), &refs))
+    if assert.Len(t, refs, 3) {
+        assert.Equal(t, []string{"apt", "brew", "dnf"}, []string{refs[0].Section, refs[1].Section, refs[2].Section})
+        assert.False(t, refs[0].Applies)
+        assert.True(t, refs[2].Applies)
+        assert.Equal(t, 7, refs[2].Line)
+        assert.Equal(t, reqs.StatusInstalled, refs[2].Status)
+        assert.Equal(t, "2.7.15", refs[2].Installed)
+    }
+
+    _, code = runReqs(t, state, "dnf", "explain", "-d", exampleDir("flask-service"), "ruby")
+    assert.Equal(t, 1, code)
+}
+
+// requirements.txt lines reach pip whole, options and markers included
+func TestE2EPipRequirementsFile(t *testing.T) {
+    dir := t.TempDir()
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "requirements.txt"), []byte(`# the service and its dependencies
+-e .
+--index-url https://pypi.org/simple
+flask==1.0.2 ; python_version >= "3"
+requests>=2.0  # http
+`), 0644))
+    // pip runs as fakepm with the state file beside it
+    pipDir := t.TempDir()
+    assert.Nil(t, os.Link(filepath.Join(binDir, "fakepm"), filepath.Join(pipDir, "pip")))
+    state := newState(t, fakepmState{})
+    _, code := runReqs(t, state, "apt", "install", "-only", "pip", "-pip", filepath.Join(pipDir, "pip"), "-d", dir)
+    assert.Equal(t, 0, code)
+
+    b, err := ioutil.ReadFile(filepath.Join(pipDir, "fakepm.json"))
+    assert.Nil(t, err)
+    var st struct{ Tools map[string]map[string]string }
+    assert.Nil(t, json.Unmarshal(b, &st))
+    assert.Equal(t, map[string]string{"flask": "1.0.2", "requests": "2.0"}, st.Tools["pip"])
+}
+
+func TestE2EPipRelativeRequirement(t *testing.T) {
+    // base.txt is only found relative to the requirements.txt naming it,
+    // reqs runs from elsewhere and pip reads a copy of the lines
+    dir := t.TempDir()
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("-r base.txt\nflask==1.0.2\n"), 0644))
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "base.txt"), []byte("requests==2.0\n"), 0644))
+    pipDir := t.TempDir()
+    assert.Nil(t, os.Link(filepath.Join(binDir, "fakepm"), filepath.Join(pipDir, "pip")))
+    state := newState(t, fakepmState{})
+    _, code := runReqs(t, state, "apt", "install", "-only", "pip", "-pip", filepath.Join(pipDir, "pip"), "-d", dir)
+    assert.Equal(t, 0, code)
+
+    b, err := ioutil.ReadFile(filepath.Join(pipDir, "fakepm.json"))
+    assert.Nil(t, err)
+    var st struct{ Tools map[string]map[string]string }
+    assert.Nil(t, json.Unmarshal(b, &st))
+    assert.Equal(t, map[string]string{"flask": "1.0.2", "requests": "2.0"}, st.Tools["pip"])
+}
+
+func TestE2EPipRefusesOptions(t *testing.T) {
+    dir := t.TempDir()
+    assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("flask==1.0.2\n--global-option build_ext\n"), 0644))
+    pipDir := t.TempDir()
+    assert.Nil(t, os.Link(filepath.Join(binDir, "fakepm"), filepath.Join(pipDir, "pip")))
+    state := newState(t, fakepmState{})
+    _, code := runReqs(t, state, "apt", "install", "-only", "pip", "-pip", filepath.Join(pipDir, "pip"), "-d", dir)
+    assert.NotEqual(t, 0, code)
+
+    _, err := os.Stat(filepath.Join(pipDir, "fakepm.json"))
+    assert.True(t, os.IsNotExist(err))
+}
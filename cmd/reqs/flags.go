@@ -0,0 +1,247 @@
+package main
+
+import (
+    "flag"
+    "github.com/iepathos/reqs"
+    log "github.com/sirupsen/logrus"
+    "strings"
+    "time"
+)
+
+// every command registers the flag groups it understands into one
+// options value, so a flag means the same thing in every command
+
+type options struct {
+    // search
+    Dir, File, Tool string
+    Stdin, Recurse  bool
+    Exclude, Names  string
+    GitIgnore       bool
+    Depth           int
+    Verbose         bool
+    Offline         bool
+
+    // output
+    Format string
+    Quiet  bool
+
+    // install
+    Update, Upgrade, Force, Plan bool
+    KeepGoing                    bool
+    // install without the confirmation prompt
+    Yes               bool
+    Pip, Pip3         string
+    SudoPip, SudoPip3 bool
+    Npm, SudoNpm      bool
+    Only              string
+
+    // list
+    Versions, Yml bool
+
+    // signatures
+    Key, TrustedKeys string
+    RequireSigned    bool
+
+    // restrictions on what is installed
+    Policy string
+
+    // timeouts
+    Timeout, StepTimeout time.Duration
+    LockTimeout          time.Duration
+}
+
+func newOptions() *options {
+    return &options{
+        Depth:       -1,
+        Format:      reqs.FormatText,
+        Key:         reqs.DefaultSecretKeyPath,
+        LockTimeout: 10 * time.Minute,
+    }
+}
+
+// where to look for requirements
+func (o *options) searchFlags(fs *flag.FlagSet) {
+    fs.StringVar(&o.Dir, "d", "", "directory or comma separated directories with requirements files")
+    fs.StringVar(&o.File, "f", "", "specific requirements file or reqs.yml to read from")
+    fs.BoolVar(&o.Stdin, "i", false, "read a requirements list or reqs.yml document from stdin")
+    fs.StringVar(&o.Tool, "tool", "", "section plain requirements from -i or -f belong to, e.g. apt or common, defaults to the detected package tool, fakepm installs with the test package tool")
+    fs.BoolVar(&o.Recurse, "r", false, "recurse down directories to find requirements")
+    fs.StringVar(&o.Exclude, "exclude", "", "comma separated glob patterns of files and directories to skip when searching for requirements")
+    fs.BoolVar(&o.GitIgnore, "gitignore", false, "skip files and directories ignored by .gitignore files when searching for requirements")
+    fs.IntVar(&o.Depth, "depth", -1, "recurse at most this many directories deep to find requirements, implies -r")
+    fs.StringVar(&o.Names, "names", "", "comma separated file names to read as reqs.yml in addition to reqs.yml, reqs.yaml and .reqs.yml")
+    fs.BoolVar(&o.Verbose, "v", false, "report every file considered when searching for requirements and why it was used or skipped")
+    fs.BoolVar(&o.Offline, "offline", false, "use only cached copies of remote includes, never fetch them")
+}
+
+func (o *options) outputFlags(fs *flag.FlagSet) {
+    fs.StringVar(&o.Format, "format", reqs.FormatText, "output format for listings and results: text, json or yaml")
+    fs.BoolVar(&o.Quiet, "q", false, "silence logging to error level")
+}
+
+func (o *options) installFlags(fs *flag.FlagSet) {
+    fs.BoolVar(&o.Update, "u", false, "update packages before install")
+    fs.BoolVar(&o.Upgrade, "up", false, "update and upgrade packages before install")
+    fs.BoolVar(&o.Force, "force", false, "force reinstall packages")
+    fs.BoolVar(&o.Plan, "plan", false, "stdout the system requirements that would be installed without installing them")
+    fs.BoolVar(&o.Yes, "y", false, "install without asking for confirmation, installs from a terminal show the plan and ask first")
+    fs.BoolVar(&o.KeepGoing, "keep-going", false, "exit zero with a warning when only optional packages fail to install, by default any failure exits 1 once everything installable is installed")
+    fs.StringVar(&o.Pip, "pip", "", "install pip dependencies from any 'requirements.txt' found, this arg must be given the path to the pip executable to use")
+    fs.StringVar(&o.Pip3, "pip3", "", "install pip3 dependencies from any 'requirements.txt' found and any pip3 entries in reqs.yml")
+    fs.BoolVar(&o.SudoPip, "spip", false, "install pip dependencies with sudo")
+    fs.BoolVar(&o.SudoPip3, "spip3", false, "install pip3 dependencies with sudo")
+    fs.BoolVar(&o.Npm, "npm", false, "install global npm dependencies reqs.yml, installs package.json files in the appropriate directories")
+    fs.BoolVar(&o.SudoNpm, "snpm", false, "install npm dependencies with sudo")
+    fs.StringVar(&o.Only, "only", "", "comma separated install steps to run: system, pip, pip3 or npm, pip selects pip3 too, by default all steps with requirements run")
+}
+
+func (o *options) timeoutFlags(fs *flag.FlagSet, steps bool) {
+    fs.DurationVar(&o.Timeout, "timeout", 0, "stop the package tools and exit 124 when the whole run takes longer, e.g. 30m, no limit by default")
+    if steps {
+        fs.DurationVar(&o.StepTimeout, "step-timeout", 0, "stop the package tool and exit 124 when one install step, system, pip, pip3 or npm, takes longer")
+    }
+}
+
+func (o *options) lockFlag(fs *flag.FlagSet) {
+    fs.DurationVar(&o.LockTimeout, "lock-timeout", 10*time.Minute, "how long to wait for the package tool's lock, or another reqs install, to be released before failing")
+}
+
+func (o *options) policyFlag(fs *flag.FlagSet) {
+    fs.StringVar(&o.Policy, "policy", "", "policy file restricting the packages and sources installed, checked along with "+reqs.DefaultPolicyPath)
+}
+
+// refusing requirements files that aren't signed
+func (o *options) verifyFlags(fs *flag.FlagSet) {
+    fs.BoolVar(&o.RequireSigned, "require-signed", false, "refuse requirements files without a signature by one of the -trusted-keys")
+    fs.StringVar(&o.TrustedKeys, "trusted-keys", "", "directory of the minisign public keys, *.pub files, trusted to sign requirements files")
+}
+
+func (o *options) listFlags(fs *flag.FlagSet) {
+    fs.BoolVar(&o.Versions, "versions", false, "include the installed version of each package")
+    fs.BoolVar(&o.Yml, "yml", false, "output the installed system packages as a reqs.yml document")
+}
+
+// check flag values and apply the settings shared by all commands,
+// stdout is kept free of logging for commands whose output is data
+func (o *options) apply(dataOutput bool) {
+    if !reqs.ValidFormat(o.Format) {
+        log.Fatal("Unsupported format '" + o.Format + "', expected text, json or yaml")
+    }
+    if ((dataOutput || o.Plan) && !o.Verbose) || o.Quiet {
+        log.SetLevel(log.ErrorLevel)
+    } else {
+        log.SetLevel(log.DebugLevel)
+    }
+
+    if o.Exclude != "" {
+        reqs.DefaultDiscovery.Exclude = strings.Split(o.Exclude, ",")
+    }
+    if o.Names != "" {
+        patterns := append([]reqs.FilePattern{}, reqs.DefaultPatterns...)
+        for _, name := range strings.Split(o.Names, ",") {
+            patterns = append(patterns, reqs.FilePattern{Name: name, Kind: reqs.KindReqsYml})
+        }
+        reqs.DefaultDiscovery.Patterns = patterns
+    }
+    reqs.DefaultDiscovery.Verbose = o.Verbose
+    reqs.DefaultDiscovery.GitIgnore = o.GitIgnore
+    reqs.DefaultDiscovery.MaxDepth = o.Depth
+    reqs.DefaultDiscovery.Offline = o.Offline
+    if o.Depth >= 0 {
+        o.Recurse = true
+    }
+    if o.RequireSigned {
+        if o.TrustedKeys == "" {
+            log.Fatal("-require-signed needs -trusted-keys, the directory of the public keys to trust")
+        }
+        keys, err := reqs.LoadTrustedKeys(o.TrustedKeys)
+        reqs.FatalCheck(err)
+        reqs.DefaultDiscovery.RequireSigned = true
+        reqs.DefaultDiscovery.TrustedKeys = keys
+    }
+
+    if o.SudoPip && o.Pip == "" {
+        o.Pip = "pip"
+    }
+    if o.SudoPip3 && o.Pip3 == "" {
+        o.Pip3 = "pip3"
+    }
+    if o.SudoNpm {
+        o.Npm = true
+    }
+}
+
+// the pip executable for a step enabled without -pip or -pip3
+func (o *options) pipPath(step string) string {
+    if step == "pip3" && o.Pip3 != "" {
+        return o.Pip3
+    }
+    if step == "pip" && o.Pip != "" {
+        return o.Pip
+    }
+    return step
+}
+
+// the install steps that run, system packages always come first so
+// pip and npm themselves can be installed from the system section
+type steps struct {
+    system, pip, pip3, npm bool
+}
+
+// -only restricts the steps, otherwise the language steps run when
+// requested with flags or when reqs.yml has a section for them
+func (o *options) installSteps(rp reqs.RequirementsParser) (s steps) {
+    sections := rp.YmlSections()
+    s = steps{
+        system: true,
+        pip:    o.Pip != "" || sections["pip"],
+        pip3:   o.Pip3 != "" || sections["pip3"],
+        npm:    o.Npm || sections["npm"],
+    }
+    if o.Only == "" {
+        return s
+    }
+    only := steps{}
+    for _, step := range strings.Split(o.Only, ",") {
+        switch strings.TrimSpace(step) {
+        case "system":
+            only.system = true
+        case "pip":
+            only.pip = true
+            only.pip3 = s.pip3
+        case "pip3":
+            only.pip3 = true
+        case "npm":
+            only.npm = true
+        default:
+            log.Fatal("Unknown install step '" + step + "' for -only, expected system, pip, pip3 or npm")
+        }
+    }
+    return only
+}
+
+func (o *options) structured() bool {
+    return o.Format != reqs.FormatText
+}
+
+func (o *options) parser() reqs.RequirementsParser {
+    rp := reqs.RequirementsParser{
+        Dir:         o.Dir,
+        File:        o.File,
+        UseStdin:    o.Stdin,
+        WithVersion: o.Versions,
+        Recurse:     o.Recurse,
+        Format:      o.Format,
+        InputTool:   o.Tool,
+    }
+    // fakepm can't be detected, so it's chosen with -tool fakepm or by
+    // tests through the environment
+    switch {
+    case o.Tool == reqs.FakeTool:
+        rp.InputTool = ""
+        rp.PackageTool = reqs.FakeTool
+    case reqs.FakeToolEnabled():
+        rp.PackageTool = reqs.FakeTool
+    }
+    return rp
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+    "context"
+    "github.com/iepathos/reqs"
+    log "github.com/sirupsen/logrus"
+    "os"
+    "strconv"
+    "time"
+)
+
+// installs are recorded in reqs.DefaultHistoryPath, reqs history lists
+// them and reqs rollback undoes one
+
+// a tool whose packages are compared before and after a transaction
+type toolCommand struct {
+    tool, command string
+    sudo          bool
+}
+
+// the system tool and the language tools the install steps run
+func (o *options) historyTools(packageTool string, s steps) []toolCommand {
+    tools := []toolCommand{{packageTool, packageTool, false}}
+    if s.pip {
+        tools = append(tools, toolCommand{"pip", o.pipPath("pip"), o.SudoPip})
+    }
+    if s.pip3 {
+        tools = append(tools, toolCommand{"pip3", o.pipPath("pip3"), o.SudoPip3})
+    }
+    if s.npm {
+        tools = append(tools, toolCommand{"npm", "npm", o.SudoNpm})
+    }
+    return tools
+}
+
+// the tools tx changed packages of
+func transactionTools(tx reqs.Transaction) []toolCommand {
+    tools := []toolCommand{{tx.Tool, tx.Tool, false}}
+    seen := map[string]bool{tx.Tool: true}
+    for _, c := range tx.Changes {
+        if !seen[c.Tool] {
+            seen[c.Tool] = true
+            tools = append(tools, toolCommand{c.Tool, c.Command, c.Sudo})
+        }
+    }
+    return tools
+}
+
+// the installed packages of tools, a language tool that can't list its
+// packages is left out of the history
+func snapshot(ctx context.Context, tools []toolCommand) reqs.Snapshot {
+    snap := reqs.Snapshot{}
+    for _, t := range tools {
+        err := snap.Add(ctx, t.tool, t.command, t.sudo)
+        if _, ok := err.(*reqs.InterruptedError); ok {
+            reqs.FatalCheck(err)
+        }
+        if err != nil {
+            log.Warn("Leaving " + t.tool + " packages out of the history: " + err.Error())
+        }
+    }
+    return snap
+}
+
+// save tx with what changed since before, unless nothing ran
+func recordTransaction(ctx context.Context, tx *reqs.Transaction, pc reqs.PackageConfig, historyStart int, before reqs.Snapshot, tools []toolCommand) {
+    tx.Record(before, snapshot(ctx, tools))
+    if historyEnd := pc.ToolHistoryID(ctx); historyStart > 0 {
+        for id := historyStart + 1; id <= historyEnd; id++ {
+            tx.ToolHistory = append(tx.ToolHistory, id)
+        }
+    }
+    if len(tx.Commands) == 0 && len(tx.Changes) == 0 {
+        return
+    }
+    if err := reqs.SaveTransaction(reqs.DefaultHistoryPath, tx); err != nil {
+        log.Warn("Failed to record the install in the history: " + err.Error())
+        return
+    }
+    id := strconv.Itoa(tx.ID)
+    if tx.RollbackOf != 0 {
+        log.Info("Recorded transaction " + id + ", " + tx.Summary())
+        return
+    }
+    log.Info("Recorded transaction " + id + ", " + tx.Summary() + ", undo it with reqs rollback " + id)
+}
+
+// list the recorded transactions, or show one
+func runHistory(o *options, args []string) {
+    history, err := reqs.LoadHistory(reqs.DefaultHistoryPath)
+    reqs.FatalCheck(err)
+    if len(args) == 0 {
+        reqs.FatalCheck(reqs.PrintHistory(os.Stdout, o.Format, history))
+        return
+    }
+    tx, _, err := reqs.FindTransaction(history, transactionID(args))
+    reqs.FatalCheck(err)
+    reqs.FatalCheck(reqs.PrintTransaction(os.Stdout, o.Format, tx))
+}
+
+func transactionID(args []string) int {
+    if len(args) != 1 {
+        log.Fatal("Expected one transaction id, see reqs history")
+    }
+    id, err := strconv.Atoi(args[0])
+    if err != nil {
+        log.Fatal("Invalid transaction id " + args[0])
+    }
+    return id
+}
+
+// undo a recorded transaction, itself recorded as a transaction
+func runRollback(ctx context.Context, o *options, args []string) {
+    id := transactionID(args)
+    history, err := reqs.LoadHistory(reqs.DefaultHistoryPath)
+    reqs.FatalCheck(err)
+    tx, rolledBack, err := reqs.FindTransaction(history, id)
+    reqs.FatalCheck(err)
+    if rolledBack {
+        log.Fatal("Transaction " + args[0] + " was already rolled back")
+    }
+    if tx.RollbackOf != 0 {
+        log.Fatal("Transaction " + args[0] + " is a rollback of " + strconv.Itoa(tx.RollbackOf) + ", install again instead")
+    }
+
+    sudo, packageTool, autoYes := o.parser().Tooling(ctx)
+    pc := reqs.PackageConfig{
+        Tool:        packageTool,
+        Sudo:        sudo,
+        AutoYes:     autoYes,
+        Quiet:       o.Quiet || o.structured(),
+        LockTimeout: o.LockTimeout,
+    }
+    lock, err := reqs.AcquireRunLock(ctx, reqs.DefaultLockPath, o.LockTimeout)
+    reqs.FatalCheck(err)
+    defer lock.Release()
+    needsSudo := sudo != ""
+    for _, c := range tx.Changes {
+        needsSudo = needsSudo || c.Sudo
+    }
+    if needsSudo {
+        reqs.FatalCheck(reqs.SudoValidate(ctx))
+    }
+
+    undo := &reqs.Transaction{Time: time.Now(), Tool: packageTool, Sources: tx.Sources, RollbackOf: id}
+    ctx = reqs.WithTransaction(ctx, undo)
+    tools := transactionTools(tx)
+    before := snapshot(ctx, tools)
+    historyStart := pc.ToolHistoryID(ctx)
+    skipped, err := pc.Rollback(ctx, tx)
+    recordTransaction(ctx, undo, pc, historyStart, before, tools)
+    reqs.FatalCheck(err)
+    for _, c := range skipped {
+        log.Warn("Couldn't undo " + c.String())
+    }
+    if o.structured() {
+        reqs.FatalCheck(reqs.PrintTransaction(os.Stdout, o.Format, *undo))
+    }
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    log "github.com/sirupsen/logrus"
+    "os"
+)
+
+// the flat flag set from before commands existed, kept for one release
+// so existing scripts keep working, each use logs its replacement
+
+func deprecated(old, replacement string) {
+    log.Warn(old + " is deprecated and will be removed in the next release, use " + replacement)
+}
+
+func legacyMain(args []string) {
+    o := newOptions()
+    fs := flag.NewFlagSet("reqs", flag.ExitOnError)
+    o.searchFlags(fs)
+    o.outputFlags(fs)
+    o.installFlags(fs)
+    o.timeoutFlags(fs, true)
+    o.lockFlag(fs)
+    useStdout := fs.Bool("o", false, "deprecated, use reqs list")
+    withVersion := fs.Bool("ov", false, "deprecated, use reqs list -versions")
+    sources := fs.Bool("so", false, "deprecated, use reqs sources")
+    yml := fs.Bool("yml", false, "deprecated, use reqs list -yml")
+    check := fs.Bool("check", false, "deprecated, use reqs check")
+    fs.Usage = func() {
+        usage()
+        fmt.Fprintln(os.Stderr, "\ndeprecated flags without a command:")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+
+    // lint and export used to follow the flags, warn before apply
+    // raises the log level for commands that output data
+    name := fs.Arg(0)
+    if o.Quiet {
+        log.SetLevel(log.ErrorLevel)
+    }
+    var run func(ctx context.Context)
+    switch {
+    case name == "lint":
+        deprecated("flags before lint", "reqs lint [flags]")
+        run = func(ctx context.Context) { runLint(o, fs.Args()[1:]) }
+    case name == "export":
+        deprecated("flags before export", "reqs export [flags] "+fs.Arg(1))
+        run = func(ctx context.Context) { runExport(o, fs.Arg(1)) }
+    case name != "":
+        log.Fatal("Unknown command " + name)
+    case *sources:
+        deprecated("-so", "reqs sources")
+        run = func(ctx context.Context) { runSources(ctx, o) }
+    case *yml:
+        deprecated("-yml", "reqs list -yml")
+        o.Yml = true
+        run = func(ctx context.Context) { runList(ctx, o) }
+    case *withVersion:
+        deprecated("-ov", "reqs list -versions")
+        o.Versions = true
+        run = func(ctx context.Context) { runList(ctx, o) }
+    case *useStdout:
+        deprecated("-o", "reqs list")
+        run = func(ctx context.Context) { runList(ctx, o) }
+    case *check:
+        deprecated("-check", "reqs check")
+        run = func(ctx context.Context) { runCheck(ctx, o) }
+    default:
+        deprecated("flags without a command", "reqs install [flags]")
+        run = func(ctx context.Context) { runInstall(ctx, o) }
+    }
+    o.apply(*useStdout || *withVersion || *sources || *yml || *check || name != "")
+    o.run(run)
+}
@@ -1,132 +1,212 @@
 package main
 
 import (
+    "context"
     "flag"
-    "github.com/iepathos/reqs"
+    "fmt"
     log "github.com/sirupsen/logrus"
     "os"
 )
 
-func main() {
-    // if arg -d then check the directory for <sys>-requirements.txt files and use them
-    // if arg -f then use the specified file for requirements
-    // if no args check the current directory
+type command struct {
+    name, args, description string
+    // registers the flag groups the command accepts
+    flags func(o *options, fs *flag.FlagSet)
+    // whether stdout carries data that logging should stay out of
+    dataOutput bool
+    run        func(ctx context.Context, o *options, args []string)
+}
 
-    dirPtr := flag.String("d", "", "directory or comma separated directories with requirements files")
-    filePtr := flag.String("f", "", "specific requirements file to read from")
-    useStdoutPtr := flag.Bool("o", false, "stdout the currently installed requirements for apt or brew")
-    useStdinPtr := flag.Bool("i", false, "use stdin for requirements")
-    withVersionPtr := flag.Bool("ov", false, "stdout the currently installed apt packages with version info")
-    quietPtr := flag.Bool("q", false, "silence logging to error level")
-    recursePtr := flag.Bool("r", false, "recurse down directories to find requirements")
-    updatePtr := flag.Bool("u", false, "update packages before install")
-    forcePtr := flag.Bool("force", false, "force reinstall packages")
-    upgradePtr := flag.Bool("up", false, "update and upgrade packages before install")
-    sourcesPtr := flag.Bool("so", false, "stdout package tool sources")
-    pipPtr := flag.String("pip", "", "install pip dependencies from any 'requirements.txt' found, this arg must be given the path to the pip executable to use")
-    pip3Ptr := flag.String("pip3", "", "install pip3 dependencies from any 'requirements.txt' found and any pip3 entries in reqs.yml")
-    sudoPipPtr := flag.Bool("spip", false, "install pip dependencies with sudo")
-    sudoPip3Ptr := flag.Bool("spip3", false, "install pip3 dependencies with sudo")
-    ymlPtr := flag.Bool("yml", false, "stdout the currently installed system requirements in yml format")
-    npmPtr := flag.Bool("npm", false, "install global npm dependencies reqs.yml, installs package.json files in the appropriate directories")
-    sudoNpmPtr := flag.Bool("snpm", false, "install npm dependencies with sudo")
-    flag.Parse()
+var commands = []command{
+    {
+        name:        "install",
+        description: "install the system requirements found in requirements files and reqs.yml, or the pip and npm requirements when -pip, -pip3 or -npm are given",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.searchFlags(fs)
+            o.outputFlags(fs)
+            o.installFlags(fs)
+            o.policyFlag(fs)
+            o.verifyFlags(fs)
+            o.timeoutFlags(fs, true)
+            o.lockFlag(fs)
+        },
+        run: func(ctx context.Context, o *options, args []string) { runInstall(ctx, o) },
+    },
+    {
+        name:        "list",
+        description: "list the installed system packages",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.outputFlags(fs)
+            o.listFlags(fs)
+            o.timeoutFlags(fs, false)
+        },
+        dataOutput: true,
+        run:        func(ctx context.Context, o *options, args []string) { runList(ctx, o) },
+    },
+    {
+        name:        "export",
+        args:        "brewfile",
+        description: "write the requirements in another tool's format, brewfile builds a Brewfile from the brew, common, taps and casks sections of reqs.yml",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.searchFlags(fs)
+        },
+        dataOutput: true,
+        run: func(ctx context.Context, o *options, args []string) {
+            if len(args) != 1 {
+                log.Fatal("export expects a format, e.g. reqs export brewfile")
+            }
+            runExport(o, args[0])
+        },
+    },
+    {
+        name:        "sources",
+        description: "list the apt sources or brew taps of the system",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.outputFlags(fs)
+            o.timeoutFlags(fs, false)
+        },
+        dataOutput: true,
+        run:        func(ctx context.Context, o *options, args []string) { runSources(ctx, o) },
+    },
+    {
+        name:        "check",
+        description: "list the system requirements that are not installed, exits 1 when any are missing",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.searchFlags(fs)
+            o.outputFlags(fs)
+            o.verifyFlags(fs)
+            o.timeoutFlags(fs, false)
+        },
+        dataOutput: true,
+        run:        func(ctx context.Context, o *options, args []string) { runCheck(ctx, o) },
+    },
+    {
+        name:        "explain",
+        args:        "<package>",
+        description: "show every requirements file entry naming a package, its section, whether installs on this system use it and why, and whether it is installed",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.searchFlags(fs)
+            o.outputFlags(fs)
+            o.verifyFlags(fs)
+            o.timeoutFlags(fs, false)
+        },
+        dataOutput: true,
+        run: func(ctx context.Context, o *options, args []string) {
+            if len(args) != 1 {
+                log.Fatal("explain expects a package, e.g. reqs explain git")
+            }
+            runExplain(ctx, o, args[0])
+        },
+    },
+    {
+        name:        "lint",
+        args:        "[file ...]",
+        description: "check reqs.yml and requirements files for mistakes, prints file:line diagnostics and exits 1 when any are found",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.searchFlags(fs)
+        },
+        dataOutput: true,
+        run: func(ctx context.Context, o *options, args []string) {
+            runLint(o, args)
+        },
+    },
+    {
+        name:        "sign",
+        args:        "[file ...]",
+        description: "write a minisign signature next to the given files, or the requirements files found and the files they include, generating a key when -key doesn't exist",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.searchFlags(fs)
+            fs.StringVar(&o.Key, "key", o.Key, "secret key to sign with, its public key is the .pub file next to it")
+        },
+        run: func(ctx context.Context, o *options, args []string) {
+            runSign(o, args)
+        },
+    },
+    {
+        name:        "history",
+        args:        "[id]",
+        description: "list the installs reqs recorded with the packages each installed or upgraded, or everything about one of them",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.outputFlags(fs)
+        },
+        dataOutput: true,
+        run: func(ctx context.Context, o *options, args []string) {
+            runHistory(o, args)
+        },
+    },
+    {
+        name:        "rollback",
+        args:        "<id>",
+        description: "undo an install from reqs history, removing the packages it installed and downgrading the ones it upgraded where the tool can",
+        flags: func(o *options, fs *flag.FlagSet) {
+            o.outputFlags(fs)
+            o.timeoutFlags(fs, false)
+            o.lockFlag(fs)
+        },
+        run: runRollback,
+    },
+}
 
-    if *withVersionPtr {
-        *useStdoutPtr = true
-    }
-    if *sourcesPtr || *useStdoutPtr || *ymlPtr {
-        log.SetLevel(log.ErrorLevel)
-    } else if !*quietPtr {
-        log.SetLevel(log.DebugLevel)
-    } else {
-        log.SetLevel(log.ErrorLevel)
+func findCommand(name string) (command, bool) {
+    for _, cmd := range commands {
+        if cmd.name == name {
+            return cmd, true
+        }
     }
+    return command{}, false
+}
 
-    if *sudoPipPtr && *pipPtr == "" {
-        *pipPtr = "pip"
-    }
-    if *sudoPip3Ptr && *pip3Ptr == "" {
-        *pip3Ptr = "pip3"
-    }
-    if *sudoNpmPtr {
-        *npmPtr = true
+func usage() {
+    fmt.Fprintln(os.Stderr, "usage: reqs <command> [flags]")
+    fmt.Fprintln(os.Stderr, "\ncommands:")
+    for _, cmd := range commands {
+        fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.description)
     }
+    fmt.Fprintln(os.Stderr, "\nRun reqs help <command> for the flags of a command, reqs without a command runs install.")
+}
 
-    rp := reqs.RequirementsParser{
-        Dir:         *dirPtr,
-        File:        *filePtr,
-        UseStdout:   *useStdoutPtr,
-        UseStdin:    *useStdinPtr,
-        WithVersion: *withVersionPtr,
-        Recurse:     *recursePtr,
-        Sources:     *sourcesPtr,
-    }
-    if *ymlPtr {
-        ymlMap := rp.GenerateReqsYml()
-        reqs.StdoutReqsYml(ymlMap)
-        os.Exit(0)
+func (cmd command) flagSet(o *options) *flag.FlagSet {
+    fs := flag.NewFlagSet("reqs "+cmd.name, flag.ExitOnError)
+    cmd.flags(o, fs)
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "usage: reqs %s [flags] %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.description)
+        fs.PrintDefaults()
     }
+    return fs
+}
 
-    if *pipPtr == "" && !*npmPtr {
-        sudo, packageTool, autoYes, requirements := rp.Parse()
-        pc := reqs.PackageConfig{
-            Tool:    packageTool,
-            Sudo:    sudo,
-            AutoYes: autoYes,
-            Reqs:    requirements,
-            Force:   *forcePtr,
-            Quiet:   *quietPtr,
-        }
-
-        if *updatePtr || *upgradePtr {
-            pc.Update()
-        }
-        if *upgradePtr {
-            pc.Upgrade()
-        }
-        pc.Install(*upgradePtr)
-    }
+func (cmd command) execute(args []string) {
+    o := newOptions()
+    fs := cmd.flagSet(o)
+    fs.Parse(args)
+    o.apply(cmd.dataOutput)
+    o.run(func(ctx context.Context) { cmd.run(ctx, o, fs.Args()) })
+}
 
-    pipRequirements := ""
-    if *pipPtr != "" {
-        pipRequirements = rp.ParsePip()
-        if pipRequirements == "" {
-            log.Warn("No pip requirements found")
-        }
+func main() {
+    if len(os.Args) < 2 {
+        install, _ := findCommand("install")
+        install.execute(nil)
+        return
     }
-    pip3Requirements := ""
-    if *pip3Ptr != "" {
-        pip3Requirements = rp.ParsePip3()
-        if pip3Requirements == "" {
-            log.Warn("No pip3 requirements found")
+    switch name := os.Args[1]; name {
+    case "help", "-h", "-help", "--help":
+        if len(os.Args) > 2 {
+            if cmd, ok := findCommand(os.Args[2]); ok {
+                cmd.flagSet(newOptions()).Usage()
+                return
+            }
         }
-    }
-    npmRequirements := ""
-    if *npmPtr {
-        npmRequirements = rp.ParseNpm()
-        if npmRequirements == "" {
-            log.Warn("No npm requirements found")
+        usage()
+    default:
+        if cmd, ok := findCommand(name); ok {
+            cmd.execute(os.Args[2:])
+            return
         }
-    }
-
-    if pipRequirements != "" {
-        reqs.PipInstall(pipRequirements, *pipPtr, *sudoPipPtr, *upgradePtr, *quietPtr)
-    }
-    if pip3Requirements != "" {
-        reqs.PipInstall(pip3Requirements, *pip3Ptr, *sudoPip3Ptr, *upgradePtr, *quietPtr)
-    }
-    if npmRequirements != "" {
-        globalArg := true
-        fromDirectory := ""
-        // install global npm requirements
-        reqs.NpmInstall(npmRequirements, fromDirectory, *sudoNpmPtr, globalArg, *quietPtr)
-        // any directories with package.json in them but where
-        // node_modules is not part of the path run just `npm install` inside
-        packageDirs := rp.FindNpmPackageDirs()
-
-        for _, pkgDir := range packageDirs {
-            reqs.NpmInstall("", pkgDir, false, false, *quietPtr)
+        if name[0] != '-' {
+            usage()
+            log.Fatal("Unknown command " + name)
         }
+        legacyMain(os.Args[1:])
     }
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "context"
+    "github.com/iepathos/reqs"
+    log "github.com/sirupsen/logrus"
+    "os"
+    "os/signal"
+    "syscall"
+)
+
+// the first SIGINT or SIGTERM cancels ctx, the running tool is sent the
+// same signal and given reqs.KillDelay to exit, a second one exits reqs
+// straight away
+func withSignals(parent context.Context) (context.Context, context.CancelFunc) {
+    ctx, cancel := context.WithCancelCause(parent)
+    sigs := make(chan os.Signal, 2)
+    signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        select {
+        case sig := <-sigs:
+            log.Warn("Received " + sig.String() + ", stopping, send it again to exit now")
+            cancel(&reqs.SignalCause{Signal: sig})
+        case <-ctx.Done():
+            return
+        }
+        sig := <-sigs
+        reqs.FatalCheck(&reqs.InterruptedError{Cause: &reqs.SignalCause{Signal: sig}})
+    }()
+    return ctx, func() {
+        signal.Stop(sigs)
+        cancel(nil)
+    }
+}
+
+// the context a command runs in, cancelled by signals and -timeout
+func (o *options) context() (context.Context, context.CancelFunc) {
+    ctx, stop := withSignals(context.Background())
+    if o.Timeout <= 0 {
+        return ctx, stop
+    }
+    ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+    return ctx, func() {
+        cancel()
+        stop()
+    }
+}
+
+// the context of one install step, limited by -step-timeout
+func (o *options) step(ctx context.Context) (context.Context, context.CancelFunc) {
+    if o.StepTimeout <= 0 {
+        return context.WithCancel(ctx)
+    }
+    return context.WithTimeout(ctx, o.StepTimeout)
+}
+
+// run with a context from o, a command interrupted between tools still
+// exits with the interruption's status
+func (o *options) run(run func(ctx context.Context)) {
+    ctx, cancel := o.context()
+    defer cancel()
+    // remote includes are fetched while requirements are read
+    reqs.DefaultDiscovery.Context = ctx
+    run(ctx)
+    if err := context.Cause(ctx); err != nil {
+        reqs.FatalCheck(&reqs.InterruptedError{Cause: err})
+    }
+}
@@ -0,0 +1,265 @@
+package reqs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// installs run from a terminal show what they will install and wait for
+// the user to confirm, abort or leave packages out
+
+// commands printing the download size of the packages appended to them,
+// as apt-cache's Size: fields or a number a line
+var sizeQueries = map[string][]string{
+	"apt":    {"apt-cache", "show", "--no-all-versions", "-q"},
+	"dnf":    {"dnf", "repoquery", "-q", "--latest-limit", "1", "--queryformat", "%{downloadsize}\n"},
+	FakeTool: {FakeTool, "show"},
+}
+
+var sizeLine = regexp.MustCompile(`(?m)^(?:Size: )?(\d+)\s*$`)
+
+// an estimate of the bytes pc.Tool downloads to install packages, not
+// counting their dependencies, false when the tool can't tell
+func (pc PackageConfig) DownloadSize(ctx context.Context, packages []string) (int64, bool) {
+	query, ok := sizeQueries[pc.Tool]
+	if !ok || len(packages) == 0 {
+		return 0, ok
+	}
+	out, err := DefaultRunner.Run(ctx, Command{Argv: append(append([]string{}, query...), packages...)})
+	if err != nil {
+		if _, ok := err.(*ExitError); !ok {
+			FatalCheck(err)
+		}
+		return 0, false
+	}
+	var size int64
+	for _, m := range sizeLine.FindAllStringSubmatch(string(out), -1) {
+		n, _ := strconv.ParseInt(m[1], 10, 64)
+		size += n
+	}
+	return size, true
+}
+
+// what an install will do, shown before it starts
+type Plan struct {
+	Requirements []Requirement
+	// directories npm install runs in, after the requirements
+	PackageDirs []string
+	// what is installed already
+	Installed Snapshot
+	// the bytes of system packages to download for the plan, false when
+	// the tool can't tell
+	Estimate func(p Plan) (int64, bool)
+}
+
+// whether r is not installed yet
+func (p Plan) IsNew(r Requirement) bool {
+	_, installed := p.Installed.Version(r.Tool, r.Name)
+	return !installed
+}
+
+// the names of the packages of tool the plan newly installs
+func (p Plan) NewPackages(tool string) (names []string) {
+	for _, r := range p.Requirements {
+		if r.Tool == tool && p.IsNew(r) {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func planSource(r Requirement) string {
+	if r.Source == "" {
+		return r.Tool + " requirements"
+	}
+	return DefaultDiscovery.Origin(r.Source)
+}
+
+// the indexes of the requirements in the order they are shown, by tool
+// in the order the tools come and then by requirements file
+func (p Plan) order() (order []int) {
+	var tools []string
+	for _, r := range p.Requirements {
+		if !StringInSlice(r.Tool, tools) {
+			tools = append(tools, r.Tool)
+		}
+	}
+	for _, tool := range tools {
+		var indexes []int
+		for i, r := range p.Requirements {
+			if r.Tool == tool {
+				indexes = append(indexes, i)
+			}
+		}
+		sort.SliceStable(indexes, func(a, b int) bool {
+			return planSource(p.Requirements[indexes[a]]) < planSource(p.Requirements[indexes[b]])
+		})
+		order = append(order, indexes...)
+	}
+	return order
+}
+
+// the plan grouped by tool and requirements file, each package numbered
+// for leaving it out
+func (p Plan) Write(w io.Writer) error {
+	var lines []string
+	tool, source := "", ""
+	newCount := 0
+	for n, i := range p.order() {
+		r := p.Requirements[i]
+		if r.Tool != tool {
+			tool, source = r.Tool, ""
+			lines = append(lines, tool)
+		}
+		if planSource(r) != source {
+			source = planSource(r)
+			lines = append(lines, "  "+source)
+		}
+		state := "installed"
+		if p.IsNew(r) {
+			state = "new"
+			newCount++
+		}
+		line := fmt.Sprintf("    %3d  %s (%s", n+1, r.Spec(), state)
+		if r.Line > 0 {
+			line += ", line " + strconv.Itoa(r.Line)
+		}
+		lines = append(lines, line+")")
+	}
+	if len(p.PackageDirs) > 0 {
+		lines = append(lines, "npm install")
+		for n, dir := range p.PackageDirs {
+			lines = append(lines, fmt.Sprintf("    %3d  %s", len(p.Requirements)+n+1, dir))
+		}
+	}
+	summary := strconv.Itoa(len(p.Requirements)) + " packages, " + strconv.Itoa(newCount) + " new"
+	if len(p.PackageDirs) > 0 {
+		summary += ", npm install in " + strconv.Itoa(len(p.PackageDirs)) + " director"
+		if len(p.PackageDirs) == 1 {
+			summary += "y"
+		} else {
+			summary += "ies"
+		}
+	}
+	if size, ok := p.downloadSize(); ok {
+		summary += ", about " + formatSize(size) + " of system packages to download"
+	} else {
+		summary += ", download size unknown"
+	}
+	_, err := io.WriteString(w, strings.Join(append(lines, summary), "\n")+"\n")
+	return err
+}
+
+func (p Plan) downloadSize() (int64, bool) {
+	if p.Estimate == nil {
+		return 0, false
+	}
+	return p.Estimate(p)
+}
+
+// the requirements numbered in a list like "2 4-6", numbers out of
+// range are an error
+func parseSelection(text string, count int) (map[int]bool, error) {
+	selected := make(map[int]bool)
+	for _, field := range strings.Fields(strings.Replace(text, ",", " ", -1)) {
+		from, to := field, field
+		if i := strings.Index(field, "-"); i > 0 {
+			from, to = field[:i], field[i+1:]
+		}
+		first, err1 := strconv.Atoi(from)
+		last, err2 := strconv.Atoi(to)
+		if err1 != nil || err2 != nil || first < 1 || last > count || first > last {
+			return nil, errors.New("no packages " + field + ", expected numbers from 1 to " + strconv.Itoa(count))
+		}
+		for n := first; n <= last; n++ {
+			selected[n-1] = true
+		}
+	}
+	return selected, nil
+}
+
+// show the plan and ask whether to go ahead until the answer is yes or
+// no, returning the plan with what was left out removed and whether to
+// install it
+func Confirm(in io.Reader, out io.Writer, p Plan) (Plan, bool, error) {
+	scanner := bufio.NewScanner(in)
+	ask := func(prompt string) (string, error) {
+		io.WriteString(out, prompt)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return strings.TrimSpace(scanner.Text()), nil
+	}
+	for {
+		if err := p.Write(out); err != nil {
+			return Plan{}, false, err
+		}
+		answer, err := ask("Install? [Y]es, [n]o, [e]xclude packages: ")
+		if err == io.EOF {
+			return Plan{}, false, nil
+		}
+		if err != nil {
+			return Plan{}, false, err
+		}
+		switch strings.ToLower(answer) {
+		case "", "y", "yes":
+			return p, true, nil
+		case "n", "no", "q":
+			return Plan{}, false, nil
+		case "e", "exclude":
+			text, err := ask("Packages to leave out, e.g. 2 4-6: ")
+			if err == io.EOF {
+				return Plan{}, false, nil
+			}
+			if err != nil {
+				return Plan{}, false, err
+			}
+			excluded, err := parseSelection(text, len(p.Requirements)+len(p.PackageDirs))
+			if err != nil {
+				io.WriteString(out, err.Error()+"\n")
+				continue
+			}
+			var kept []Requirement
+			for n, i := range p.order() {
+				if !excluded[n] {
+					kept = append(kept, p.Requirements[i])
+				}
+			}
+			var keptDirs []string
+			for n, dir := range p.PackageDirs {
+				if !excluded[len(p.Requirements)+n] {
+					keptDirs = append(keptDirs, dir)
+				}
+			}
+			p.Requirements, p.PackageDirs = kept, keptDirs
+			if len(kept) == 0 && len(keptDirs) == 0 {
+				return p, true, nil
+			}
+		default:
+			io.WriteString(out, "Answer y, n or e\n")
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package reqs
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func testPlan() Plan {
+	return Plan{
+		Requirements: []Requirement{
+			{Name: "git", Tool: "apt", Source: "b/reqs.yml", Line: 2},
+			{Name: "curl", Tool: "apt", Source: "a/apt-requirements.txt", Line: 1},
+			NewRequirement("Flask==1.0", "pip"),
+			NewRequirement("requests", "pip"),
+		},
+		Installed: Snapshot{
+			"apt": {Versions: map[string]string{"git": "1:2.17.1"}},
+			"pip": {Versions: map[string]string{"flask": "1.0"}},
+		},
+		Estimate: func(p Plan) (int64, bool) {
+			return int64(len(p.NewPackages("apt"))) * 3 << 20, true
+		},
+	}
+}
+
+func TestPlanWrite(t *testing.T) {
+	var out bytes.Buffer
+	assert.Nil(t, testPlan().Write(&out))
+	assert.Equal(t, `apt
+  a/apt-requirements.txt
+      1  curl (new, line 1)
+  b/reqs.yml
+      2  git (installed, line 2)
+pip
+  pip requirements
+      3  Flask==1.0 (installed)
+      4  requests (new)
+4 packages, 2 new, about 3.0 MB of system packages to download
+`, out.String())
+}
+
+func TestPlanPackageDirs(t *testing.T) {
+	p := testPlan()
+	p.PackageDirs = []string{"web", "api"}
+	var out bytes.Buffer
+	assert.Nil(t, p.Write(&out))
+	assert.Contains(t, out.String(), `      4  requests (new)
+npm install
+      5  web
+      6  api
+4 packages, 2 new, npm install in 2 directories, about 3.0 MB of system packages to download
+`)
+
+	// leaving out every package and directory installs nothing
+	kept, ok, err := Confirm(strings.NewReader("e\n1-3 5\ne\n1-2\n"), &out, p)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, kept.Requirements)
+	assert.Empty(t, kept.PackageDirs)
+	assert.Contains(t, out.String(), "      2  api\n1 packages, 1 new, npm install in 1 directory")
+}
+
+func TestPlanIsNew(t *testing.T) {
+	p := Plan{Installed: Snapshot{"dnf": {Versions: map[string]string{"git.x86_64": "2.17.1"}}}}
+	assert.False(t, p.IsNew(Requirement{Name: "git", Tool: "dnf"}))
+	assert.True(t, p.IsNew(Requirement{Name: "curl", Tool: "dnf"}))
+}
+
+func TestConfirm(t *testing.T) {
+	var out bytes.Buffer
+	kept, ok, err := Confirm(strings.NewReader("e\n1 9\ne\n1, 3-4\ny\n"), &out, testPlan())
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []Requirement{{Name: "git", Tool: "apt", Source: "b/reqs.yml", Line: 2}}, kept.Requirements)
+	assert.Contains(t, out.String(), "no packages 9, expected numbers from 1 to 4\n")
+	assert.Contains(t, out.String(), "1 packages, 0 new, about 0 B of system packages to download\n")
+
+	_, ok, err = Confirm(strings.NewReader("n\n"), &out, testPlan())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	// closing stdin aborts too
+	_, ok, err = Confirm(strings.NewReader(""), &out, testPlan())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestDownloadSize(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Results["apt-cache show --no-all-versions -q git curl"] = FakeResult{Stdout: `Package: git
+Installed-Size: 34000
+Size: 3900000
+
+Package: curl
+Size: 159000
+`}
+	size, ok := PackageConfig{Tool: "apt"}.DownloadSize(context.Background(), []string{"git", "curl"})
+	assert.True(t, ok)
+	assert.Equal(t, int64(4059000), size)
+	_, ok = PackageConfig{Tool: "brew"}.DownloadSize(context.Background(), []string{"git"})
+	assert.False(t, ok)
+}
@@ -0,0 +1,353 @@
+package reqs
+
+import (
+	"bufio"
+	"context"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// walking directories for requirements files, pruning directories
+// that never hold a project's own requirements
+
+// directories skipped wherever they appear
+var DefaultIgnoreDirs = []string{
+	".git",
+	".hg",
+	".svn",
+	"node_modules",
+	"bower_components",
+	"vendor",
+	"__pycache__",
+	".tox",
+	".venv",
+	"venv",
+	"dist",
+	"build",
+}
+
+const reqsIgnoreFile = ".reqsignore"
+
+// kinds of requirements files
+const (
+	KindReqsYml = "reqs.yml"
+	// <tool>-requirements.txt, the tool is the part matched by *
+	KindToolRequirements = "tool requirements"
+	KindPipRequirements  = "pip requirements"
+	// pip requirements only read on darwin
+	KindPipDarwinRequirements = "darwin pip requirements"
+	KindBrewfile              = "Brewfile"
+)
+
+// a file name glob matched exactly against the base name of a file
+type FilePattern struct {
+	Name string
+	Kind string
+}
+
+var DefaultPatterns = []FilePattern{
+	{"reqs.yml", KindReqsYml},
+	{"reqs.yaml", KindReqsYml},
+	{".reqs.yml", KindReqsYml},
+	{"*-requirements.txt", KindToolRequirements},
+	{"requirements.txt", KindPipRequirements},
+	{"requirements-osx.txt", KindPipDarwinRequirements},
+	{"Brewfile", KindBrewfile},
+}
+
+// a discovered requirements file
+type RequirementsFile struct {
+	Path, Kind string
+	// the tool of a <tool>-requirements.txt file
+	Tool string
+}
+
+type Discovery struct {
+	// glob patterns excluded in addition to .reqsignore files
+	Exclude []string
+	// also honour .gitignore files
+	GitIgnore bool
+	// how many directories below the starting directory to recurse,
+	// negative for no limit
+	MaxDepth int
+	// requirements file names, DefaultPatterns when empty
+	Patterns []FilePattern
+	// report every file and directory considered and why it was
+	// accepted or skipped
+	Verbose bool
+	// where remote includes are cached, DefaultIncludeCache when empty
+	CacheDir string
+	// use only cached remote includes, never fetch them
+	Offline bool
+	// refuse requirements files without a signature by one of
+	// TrustedKeys
+	RequireSigned bool
+	TrustedKeys   []PublicKey
+	// cancels fetching remote includes, context.Background() when nil
+	Context context.Context
+	// the urls cached remote includes were fetched from
+	origins map[string]string
+	// the contents of the files Verify checked, by absolute path
+	verified map[string][]byte
+}
+
+// settings used by GetRequirementFilenames and FindNpmPackageDirs
+var DefaultDiscovery = &Discovery{MaxDepth: -1}
+
+func (d *Discovery) context() context.Context {
+	if d.Context == nil {
+		return context.Background()
+	}
+	return d.Context
+}
+
+func (d *Discovery) patterns() []FilePattern {
+	if len(d.Patterns) == 0 {
+		return DefaultPatterns
+	}
+	return d.Patterns
+}
+
+// match the base name of path against the requirements file patterns,
+// ok is false for files that are not requirements files
+func (d *Discovery) Classify(path string) (rf RequirementsFile, ok bool) {
+	base := filepath.Base(path)
+	for _, p := range d.patterns() {
+		if matched, _ := filepath.Match(p.Name, base); !matched {
+			continue
+		}
+		rf = RequirementsFile{Path: path, Kind: p.Kind}
+		if p.Kind == KindToolRequirements {
+			if i := strings.Index(p.Name, "*"); i != -1 {
+				suffix := p.Name[i+1:]
+				rf.Tool = base[i : len(base)-len(suffix)]
+			}
+		}
+		return rf, true
+	}
+	return rf, false
+}
+
+// like Classify for a file named on purpose, where other .yml and .yaml
+// files are read as reqs.yml
+func (d *Discovery) classifyNamed(path string) (rf RequirementsFile, ok bool) {
+	if rf, ok = d.Classify(path); ok {
+		return rf, true
+	}
+	if ext := filepath.Ext(path); ext == ".yml" || ext == ".yaml" {
+		return RequirementsFile{Path: path, Kind: KindReqsYml}, true
+	}
+	return rf, false
+}
+
+// the requirements files in dirPath, descending into subdirectories
+// when recurse is set
+func (d *Discovery) Find(dirPath string, recurse bool) (files []RequirementsFile, err error) {
+	err = d.Walk(dirPath, recurse, func(path string, info os.FileInfo) {
+		rf, ok := d.Classify(path)
+		if !ok {
+			d.report("Skipping " + path + ", " + filepath.Base(path) + " is not a requirements file name")
+			return
+		}
+		d.report("Accepting " + path + " as " + rf.Kind)
+		files = append(files, rf)
+	})
+	return files, err
+}
+
+func (d *Discovery) report(msg string) {
+	if d.Verbose {
+		log.Info(msg)
+	}
+}
+
+// a single line of an ignore file or exclude pattern
+type ignoreRule struct {
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// patterns without a slash match the name at any depth
+	nameOnly bool
+}
+
+// call fn for every file in dir that is not ignored, descending into
+// subdirectories when recurse is set
+func (d *Discovery) Walk(dir string, recurse bool, fn func(path string, info os.FileInfo)) error {
+	var rules []ignoreRule
+	for _, pattern := range d.Exclude {
+		if rule, ok := newIgnoreRule(dir, pattern); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return d.walk(dir, 0, recurse, rules, make(map[string]bool), fn)
+}
+
+func (d *Discovery) walk(dir string, depth int, recurse bool, rules []ignoreRule, visited map[string]bool, fn func(path string, info os.FileInfo)) error {
+	// symlinked directories are followed once, a link back up the
+	// tree would otherwise recurse forever
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if abs, err := filepath.Abs(real); err == nil {
+			real = abs
+		}
+		if visited[real] {
+			d.report("Skipping directory " + dir + ", already visited through a symlink")
+			return nil
+		}
+		visited[real] = true
+	}
+
+	rules = append(rules[:len(rules):len(rules)], readIgnoreFile(dir, reqsIgnoreFile)...)
+	if d.GitIgnore {
+		rules = append(rules, readIgnoreFile(dir, ".gitignore")...)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info := entry
+		if entry.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(path)
+			if err != nil {
+				d.report("Skipping broken symlink " + path)
+				continue
+			}
+		}
+		if ignored(path, info.IsDir(), rules) {
+			d.report("Skipping " + path + ", matched by an ignore pattern")
+			continue
+		}
+		if !info.IsDir() {
+			fn(path, info)
+			continue
+		}
+		if !recurse {
+			d.report("Skipping directory " + path + ", not recursing")
+			continue
+		}
+		if d.MaxDepth >= 0 && depth >= d.MaxDepth {
+			d.report("Skipping directory " + path + ", deeper than -depth")
+			continue
+		}
+		if isIgnoredDir(path) {
+			d.report("Skipping directory " + path + ", ignored by default")
+			continue
+		}
+		if err := d.walk(path, depth+1, recurse, rules, visited, fn); err != nil {
+			log.Warn(err)
+		}
+	}
+	return nil
+}
+
+// default ignored directories and python virtualenvs
+func isIgnoredDir(path string) bool {
+	if StringInSlice(filepath.Base(path), DefaultIgnoreDirs) {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(path, "pyvenv.cfg"))
+	return err == nil
+}
+
+// the last matching rule decides, so later negated rules can re-include
+func ignored(path string, isDir bool, rules []ignoreRule) (ignore bool) {
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		target := filepath.Base(path)
+		if !rule.nameOnly {
+			rel, err := filepath.Rel(rule.base, path)
+			if err != nil {
+				continue
+			}
+			target = filepath.ToSlash(rel)
+		}
+		if rule.re.MatchString(target) {
+			ignore = !rule.negate
+		}
+	}
+	return ignore
+}
+
+// read gitignore style patterns from dir/name if it exists
+func readIgnoreFile(dir, name string) (rules []ignoreRule) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := newIgnoreRule(dir, scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func newIgnoreRule(base, pattern string) (rule ignoreRule, ok bool) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return rule, false
+	}
+	rule.base = base
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	rule.nameOnly = !strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	re, err := regexp.Compile("^" + globToRegexp(pattern) + "$")
+	if err != nil {
+		log.Warn("Ignoring invalid pattern " + pattern)
+		return rule, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// translate a glob with ** support into a regular expression
+func globToRegexp(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			re.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end == -1 {
+				re.WriteString(regexp.QuoteMeta(string(c)))
+			} else {
+				re.WriteString(strings.Replace(glob[i:i+end+1], "[!", "[^", 1))
+				i += end
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
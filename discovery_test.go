@@ -0,0 +1,104 @@
+package reqs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func walkedFiles(t *testing.T, d *Discovery, dir string) (files []string) {
+	err := d.Walk(dir, true, func(path string, info os.FileInfo) {
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+	})
+	assert.Nil(t, err)
+	sort.Strings(files)
+	return files
+}
+
+func TestDiscoveryWalkIgnores(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		".reqsignore":                          "# comment\nold/\n*.bak\n!keep.bak\n",
+		".gitignore":                           "generated/\n",
+		"reqs.yml":                             "",
+		"reqs.yml.bak":                         "",
+		"keep.bak":                             "",
+		"old/reqs.yml":                         "",
+		"generated/reqs.yml":                   "",
+		"node_modules/left-pad/reqs.yml":       "",
+		"env/pyvenv.cfg":                       "",
+		"env/lib/requirements.txt":             "",
+		"service/reqs.yml":                     "",
+		"service/fixtures/reqs.yml":            "",
+		"service/deep/deeper/requirements.txt": "",
+	})
+	defer os.RemoveAll(dir)
+
+	d := &Discovery{MaxDepth: -1}
+	assert.Equal(t, []string{
+		".gitignore",
+		".reqsignore",
+		"generated/reqs.yml",
+		"keep.bak",
+		"reqs.yml",
+		"service/deep/deeper/requirements.txt",
+		"service/fixtures/reqs.yml",
+		"service/reqs.yml",
+	}, walkedFiles(t, d, dir))
+
+	d = &Discovery{MaxDepth: 1, GitIgnore: true, Exclude: []string{"service/fixtures", ".*ignore"}}
+	assert.Equal(t, []string{
+		"keep.bak",
+		"reqs.yml",
+		"service/reqs.yml",
+	}, walkedFiles(t, d, dir))
+}
+
+func TestDiscoveryWalkSymlinkLoop(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"a/reqs.yml": "",
+	})
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.Symlink(dir, filepath.Join(dir, "a", "loop")))
+
+	assert.Equal(t, []string{"a/reqs.yml"}, walkedFiles(t, &Discovery{MaxDepth: -1}, dir))
+}
+
+func TestDiscoveryFindExactNames(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml":                   "",
+		"reqs.yml.bak":               "",
+		"old-reqs.yml.orig":          "",
+		"reqs.yml.d/extra.txt":       "",
+		"a/reqs.yaml":                "",
+		"a/.reqs.yml":                "",
+		"a/apt-requirements.txt":     "",
+		"a/requirements.txt":         "",
+		"a/requirements.txt.lock":    "",
+		"a/requirements-osx.txt":     "",
+		"a/Brewfile":                 "",
+		"a/Brewfile.lock.json":       "",
+		"a/common-requirements.txt~": "",
+	})
+	defer os.RemoveAll(dir)
+
+	files, err := (&Discovery{MaxDepth: -1}).Find(dir, true)
+	assert.Nil(t, err)
+	var got []string
+	for _, rf := range files {
+		rel, _ := filepath.Rel(dir, rf.Path)
+		got = append(got, filepath.ToSlash(rel)+" "+rf.Kind+" "+rf.Tool)
+	}
+	sort.Strings(got)
+	assert.Equal(t, []string{
+		"a/.reqs.yml reqs.yml ",
+		"a/Brewfile Brewfile ",
+		"a/apt-requirements.txt tool requirements apt",
+		"a/reqs.yaml reqs.yml ",
+		"a/requirements-osx.txt darwin pip requirements ",
+		"a/requirements.txt pip requirements ",
+		"reqs.yml reqs.yml ",
+	}, got)
+}
@@ -1,15 +1,24 @@
 package reqs
 
 import (
-	"os/exec"
+	"context"
 	"strings"
 )
 
-func DnfListInstalled(withVersion bool) (reqs string) {
-	out, err := exec.Command("dnf", "list", "installed").Output()
+func DnfListInstalled(ctx context.Context, withVersion bool) (reqs string) {
+	out, err := commandOutput(ctx, "dnf", "list", "installed")
 	FatalCheck(err)
-	for _, line := range strings.Split(string(out), "\n")[1:] {
-		lSplit := strings.Split(string(line), " ")
+	return parseDnfList(string(out), withVersion)
+}
+
+// parse the output of dnf list installed
+func parseDnfList(out string, withVersion bool) (reqs string) {
+	for _, line := range strings.Split(out, "\n")[1:] {
+		// columns are padded with a varying number of spaces
+		lSplit := strings.Fields(line)
+		if len(lSplit) < 2 {
+			continue
+		}
 		req := lSplit[0]
 		if withVersion {
 			req = req + "=" + lSplit[1]
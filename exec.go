@@ -0,0 +1,227 @@
+package reqs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// running package tools without a shell, every argument reaches the
+// tool exactly as given.  All commands go through DefaultRunner so tests
+// can script them and embedders can run them elsewhere, e.g. over ssh
+
+type Command struct {
+	Argv []string
+	// the complete environment, nil inherits the environment of reqs
+	Env []string
+	// working directory, empty for the current one
+	Dir string
+	// run in the foreground with the terminal, for commands that prompt
+	Interactive bool
+	// also receives stdout as the command writes it
+	Stdout io.Writer
+}
+
+func (c Command) String() string {
+	return strings.Join(c.Argv, " ")
+}
+
+// a command that ran and exited non zero
+type ExitError struct {
+	Command  Command
+	ExitCode int
+	// the last lines the command wrote to stderr
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	msg := e.Command.String() + " exited with status " + strconv.Itoa(e.ExitCode)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// the cause of a cancelled context when reqs received a signal, the
+// running command is sent the same signal
+type SignalCause struct {
+	Signal os.Signal
+}
+
+func (s *SignalCause) Error() string {
+	return "received " + s.Signal.String()
+}
+
+// a command stopped because its context was cancelled or timed out
+type InterruptedError struct {
+	// the command running, if any
+	Command Command
+	Cause   error
+}
+
+func (e *InterruptedError) Error() string {
+	cause := "cancelled"
+	if errors.Is(e.Cause, context.DeadlineExceeded) {
+		cause = "timed out"
+	} else if e.Cause != nil {
+		cause = e.Cause.Error()
+	}
+	if len(e.Command.Argv) == 0 {
+		return "interrupted: " + cause
+	}
+	return "interrupted during " + e.Command.String() + ": " + cause
+}
+
+// 124 for timeouts like timeout(1), 128 plus the signal number for signals
+func (e *InterruptedError) ExitCode() int {
+	var sc *SignalCause
+	if errors.As(e.Cause, &sc) {
+		if sig, ok := sc.Signal.(syscall.Signal); ok {
+			return 128 + int(sig)
+		}
+	}
+	if errors.Is(e.Cause, context.DeadlineExceeded) {
+		return 124
+	}
+	return 1
+}
+
+func interrupted(ctx context.Context, c Command) error {
+	return &InterruptedError{Command: c, Cause: context.Cause(ctx)}
+}
+
+type Runner interface {
+	// run the command and return its stdout, a non zero exit is an
+	// *ExitError and a cancelled ctx stops the command with an
+	// *InterruptedError
+	Run(ctx context.Context, c Command) ([]byte, error)
+	// the path of an executable, like exec.LookPath
+	LookPath(name string) (string, error)
+}
+
+// how long a signalled command gets to exit before it's killed
+var KillDelay = 10 * time.Second
+
+// runs commands on this machine with os/exec, each in its own process
+// group so a cancelled context signals the tool and everything it started
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, c Command) ([]byte, error) {
+	if ctx.Err() != nil {
+		return nil, interrupted(ctx, c)
+	}
+	cmd := exec.Command(c.Argv[0], c.Argv[1:]...)
+	cmd.Env = c.Env
+	cmd.Dir = c.Dir
+	var stdout bytes.Buffer
+	stderr := tailBuffer{max: stderrTail}
+	cmd.Stdout = &stdout
+	if c.Stdout != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, c.Stdout)
+	}
+	cmd.Stderr = &stderr
+	if c.Interactive {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	} else {
+		// a background group can't read the terminal, so prompts have
+		// to be interactive commands
+		setProcessGroup(cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			signalCommand(cmd, cancelSignal(ctx))
+			select {
+			case <-done:
+			case <-time.After(KillDelay):
+				signalCommand(cmd, os.Kill)
+			}
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	if ctx.Err() != nil {
+		return stdout.Bytes(), interrupted(ctx, c)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code := -1
+		if status, ok := exitErr.Sys().(interface{ ExitStatus() int }); ok {
+			code = status.ExitStatus()
+		}
+		return stdout.Bytes(), &ExitError{Command: c, ExitCode: code, Stderr: stderr.String()}
+	}
+	return stdout.Bytes(), err
+}
+
+// how much stderr an ExitError keeps
+const stderrTail = 8 << 10
+
+// keeps the last max bytes written, cut back to the start of a line
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		cut := len(t.buf) - t.max
+		if i := bytes.IndexByte(t.buf[cut:], '\n'); i >= 0 {
+			cut += i + 1
+		}
+		t.buf = append([]byte{}, t.buf[cut:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
+
+func (ExecRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+// the signal reqs received, otherwise SIGTERM
+func cancelSignal(ctx context.Context) os.Signal {
+	var sc *SignalCause
+	if errors.As(context.Cause(ctx), &sc) {
+		return sc.Signal
+	}
+	return syscall.SIGTERM
+}
+
+var DefaultRunner Runner = ExecRunner{}
+
+// run argv with DefaultRunner and return its stdout
+func commandOutput(ctx context.Context, argv ...string) ([]byte, error) {
+	return DefaultRunner.Run(ctx, Command{Argv: argv})
+}
+
+// ask for the sudo password up front, tools run in their own process
+// group can't read it from the terminal
+func SudoValidate(ctx context.Context) error {
+	_, err := DefaultRunner.Run(ctx, Command{Argv: []string{"sudo", "-v"}, Interactive: true})
+	return err
+}
+
+// quote argv for the one place a remote shell is unavoidable
+func shellQuote(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,145 @@
+package reqs
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// swap DefaultRunner for a fake for the rest of the test
+func useFakeRunner(t *testing.T) *FakeRunner {
+	fake := NewFakeRunner()
+	prev := DefaultRunner
+	DefaultRunner = fake
+	t.Cleanup(func() { DefaultRunner = prev })
+	return fake
+}
+
+func TestAptListInstalled(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Results["apt list --installed"] = FakeResult{Stdout: `Listing... Done
+git/bionic-updates,now 1:2.17.1-1ubuntu0.4 amd64 [installed]
+libc6/bionic,now 2.27-3ubuntu1 amd64 [installed,automatic]
+`}
+	assert.Equal(t, "git\nlibc6", AptListInstalled(context.Background(), false))
+	assert.Equal(t, "git=1:2.17.1-1ubuntu0.4\nlibc6=2.27-3ubuntu1", AptListInstalled(context.Background(), true))
+	assert.Equal(t, []string{"apt list --installed", "apt list --installed"}, fake.CommandLines())
+}
+
+func TestDnfListInstalled(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Results["dnf list installed"] = FakeResult{Stdout: `Installed Packages
+git.x86_64                     2.17.1-3.fc28             @updates
+python3-pip.noarch             9.0.3-2.fc28              @fedora
+`}
+	assert.Equal(t, "git.x86_64\npython3-pip.noarch", DnfListInstalled(context.Background(), false))
+	assert.Equal(t, "git.x86_64=2.17.1-3.fc28\npython3-pip.noarch=9.0.3-2.fc28", DnfListInstalled(context.Background(), true))
+}
+
+func TestInstallFlow(t *testing.T) {
+	fake := useFakeRunner(t)
+	pc := PackageConfig{Tool: "apt", Sudo: "sudo", AutoYes: "-y", Reqs: "git curl", Quiet: true}
+	pc.Update(context.Background())
+	pc.Upgrade(context.Background())
+	pc.Install(context.Background(), true)
+	assert.Equal(t, []string{
+		"sudo apt update -y",
+		"sudo apt upgrade -y",
+		"sudo apt install -y --upgrade git curl",
+	}, fake.CommandLines())
+
+	fake = useFakeRunner(t)
+	pc = PackageConfig{Tool: "brew", Reqs: "git", Force: true, Quiet: true}
+	pc.Install(context.Background(), false)
+	assert.Equal(t, []string{"brew install --force git"}, fake.CommandLines())
+	assert.Contains(t, fake.Calls[0].Env, "HOMEBREW_NO_AUTO_UPDATE=1")
+}
+
+func TestBootstrap(t *testing.T) {
+	fake := useFakeRunner(t)
+	pc := PackageConfig{Tool: "dnf", Sudo: "sudo", AutoYes: "-y", Quiet: true}
+	fake.Commands = []string{"npm"}
+	assert.Empty(t, pc.Prerequisites("npm", "npm"))
+	prereqs := pc.Prerequisites("pip3", "pip3")
+	assert.Equal(t, "python3-pip", RequirementsList(prereqs))
+}
+
+func TestFakeRunnerResults(t *testing.T) {
+	fake := NewFakeRunner()
+	fake.Results["apt install"] = FakeResult{Stderr: "E: Unable to locate package nope", ExitCode: 100}
+	fake.Results["apt install -y git"] = FakeResult{Stdout: "ok"}
+
+	out, err := fake.Run(context.Background(), Command{Argv: []string{"apt", "install", "-y", "git"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", string(out))
+
+	_, err = fake.Run(context.Background(), Command{Argv: []string{"apt", "install", "-y", "nope"}})
+	exitErr, ok := err.(*ExitError)
+	assert.True(t, ok)
+	assert.Equal(t, 100, exitErr.ExitCode)
+	assert.Contains(t, err.Error(), "Unable to locate package")
+
+	out, err = fake.Run(context.Background(), Command{Argv: []string{"apt", "update"}})
+	assert.Nil(t, err)
+	assert.Empty(t, out)
+}
+
+func TestInstallFallback(t *testing.T) {
+	fake := useFakeRunner(t)
+	// batches holding nope or gone fail
+	for _, batch := range []string{"git curl nope wget gone", "nope wget gone", "wget gone"} {
+		fake.Results["apt install -y "+batch] = FakeResult{ExitCode: 100}
+	}
+	for _, name := range []string{"nope", "gone"} {
+		fake.Results["apt install -y "+name] = FakeResult{Stderr: "Reading package lists...\nE: Unable to locate package " + name, ExitCode: 100}
+	}
+	pc := PackageConfig{Tool: "apt", AutoYes: "-y", Reqs: "git curl nope wget gone", Quiet: true}
+	failures := pc.Install(context.Background(), false)
+	assert.Equal(t, []InstallFailure{
+		{Package: "nope", Reason: "E: Unable to locate package nope"},
+		{Package: "gone", Reason: "E: Unable to locate package gone"},
+	}, failures)
+	assert.Contains(t, fake.CommandLines(), "apt install -y wget")
+
+	found := WithFailures(RequirementsFromList("git nope", "apt"), failures)
+	assert.Equal(t, StatusInstalled, found[0].Status)
+	assert.Equal(t, StatusFailed, found[1].Status)
+	assert.Equal(t, "E: Unable to locate package nope", found[1].Error)
+}
+
+func TestInterrupted(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Results["apt install"] = FakeResult{Hang: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := DefaultRunner.Run(ctx, Command{Argv: []string{"apt", "install", "-y", "git"}})
+	ie, ok := err.(*InterruptedError)
+	assert.True(t, ok)
+	assert.Equal(t, "interrupted during apt install -y git: timed out", ie.Error())
+	assert.Equal(t, 124, ie.ExitCode())
+	// nothing runs once ctx is done
+	_, err = DefaultRunner.Run(ctx, Command{Argv: []string{"apt", "update"}})
+	assert.IsType(t, &InterruptedError{}, err)
+	assert.Equal(t, []string{"apt install -y git"}, fake.CommandLines())
+
+	signalled := &InterruptedError{Cause: &SignalCause{Signal: syscall.SIGINT}}
+	assert.Equal(t, "interrupted: received interrupt", signalled.Error())
+	assert.Equal(t, 130, signalled.ExitCode())
+}
+
+func TestExecRunnerCancel(t *testing.T) {
+	if !IsCommandAvailable("sleep") {
+		t.Skip("sleep not available")
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(10*time.Millisecond, func() { cancel(&SignalCause{Signal: syscall.SIGINT}) })
+	start := time.Now()
+	_, err := ExecRunner{}.Run(ctx, Command{Argv: []string{"sleep", "30"}})
+	assert.Less(t, time.Since(start), KillDelay)
+	ie, ok := err.(*InterruptedError)
+	assert.True(t, ok)
+	assert.Equal(t, "interrupted during sleep 30: received interrupt", ie.Error())
+	assert.Equal(t, 130, ie.ExitCode())
+}
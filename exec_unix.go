@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package reqs
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signal the command's process group, or just the command when it
+// shares the group of reqs
+func signalCommand(cmd *exec.Cmd, sig os.Signal) {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+		return
+	}
+	cmd.Process.Signal(sig)
+}
@@ -0,0 +1,12 @@
+package reqs
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func signalCommand(cmd *exec.Cmd, sig os.Signal) {
+	cmd.Process.Kill()
+}
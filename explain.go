@@ -0,0 +1,224 @@
+package reqs
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reqs explain traces a package through the requirements files, every
+// entry naming it, the section it is in and whether that section is
+// installed on this system
+
+// a requirements file entry naming the explained package
+type Reference struct {
+	Requirement `yaml:",inline"`
+	// whether an install on this system installs the entry
+	Applies bool   `json:"applies" yaml:"applies"`
+	Reason  string `json:"reason" yaml:"reason"`
+	// the installed version, when Status is installed
+	Installed string `json:"installed,omitempty" yaml:"installed,omitempty"`
+}
+
+// every entry naming the package name in the requested directories, file
+// or stdin, or the current directory, with its installed status from
+// installed for the tools it has
+func (rp RequirementsParser) Explain(name, packageTool string, installed Snapshot) (refs []Reference) {
+	switch {
+	case rp.Dir != "":
+		for _, dirPath := range strings.Split(rp.Dir, ",") {
+			for _, rf := range findRequirementsFiles(dirPath, rp.Recurse) {
+				refs = append(refs, explainFile(rf, name, packageTool)...)
+			}
+		}
+	case rp.File != "":
+		refs = rp.explainInput(readRequirementsFile(rp.File), rp.File, name, packageTool)
+	case rp.UseStdin:
+		refs = rp.explainInput(readRequirementsStdin(), "stdin", name, packageTool)
+	default:
+		for _, rf := range findRequirementsFiles(".", rp.Recurse) {
+			refs = append(refs, explainFile(rf, name, packageTool)...)
+		}
+	}
+	for i, ref := range refs {
+		if _, ok := installed[ref.Tool]; !ok {
+			continue
+		}
+		refs[i].Status = StatusMissing
+		for _, n := range append([]string{ref.Name}, ref.Alternatives...) {
+			n, _ = splitVersion(n, ref.Tool)
+			if version, ok := installed.Version(ref.Tool, n); ok {
+				refs[i].Status, refs[i].Installed = StatusInstalled, version
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// the references in a reqs.yml document or a plain requirements list
+// belonging to the InputTool section
+func (rp RequirementsParser) explainInput(b []byte, source, name, packageTool string) []Reference {
+	if isReqsYml(string(b)) {
+		refs := explainYml(b, source, name, packageTool)
+		for _, rf := range includedFiles(b, source) {
+			refs = append(refs, explainFile(rf, name, packageTool)...)
+		}
+		return refs
+	}
+	section := rp.InputTool
+	if section == "" {
+		section = packageTool
+	}
+	applies, reason := sectionApplies(section, packageTool)
+	return explainText(string(b), source, section, name, packageTool, applies, reason)
+}
+
+func explainFile(rf RequirementsFile, name, packageTool string) []Reference {
+	b := readRequirements(rf.Path)
+	system := emulatedTool(packageTool)
+	switch rf.Kind {
+	case KindReqsYml:
+		return explainYml(b, rf.Path, name, packageTool)
+	case KindToolRequirements:
+		applies, reason := sectionApplies(rf.Tool, packageTool)
+		if !StringInSlice(rf.Tool, append([]string{"common", "npm"}, systemSections...)) {
+			applies, reason = false, "reqs doesn't read "+rf.Tool+"-requirements.txt files"
+		}
+		return explainText(string(b), rf.Path, rf.Tool, name, packageTool, applies, reason)
+	case KindPipRequirements:
+		return explainText(string(b), rf.Path, "pip", name, packageTool, true, "requirements.txt files are installed by the pip and pip3 steps")
+	case KindPipDarwinRequirements:
+		applies, reason := runtime.GOOS == "darwin", "requirements-osx.txt files are installed by the pip and pip3 steps on darwin"
+		if !applies {
+			reason = "requirements-osx.txt files are only installed on darwin, this system is " + runtime.GOOS
+		}
+		return explainText(string(b), rf.Path, "pip", name, packageTool, applies, reason)
+	case KindBrewfile:
+		applies, reason := system == "brew", "Brewfiles are installed on brew systems"
+		if !applies {
+			reason = "Brewfiles are only installed on brew systems, this one uses " + system
+		}
+		return explainText(ParseBrewfile(string(b)), rf.Path, "brew", name, packageTool, applies, reason)
+	}
+	return nil
+}
+
+// the entries of every section of a reqs.yml document naming name, by line
+func explainYml(b []byte, source, name, packageTool string) (refs []Reference) {
+	conf := ymlBytesToMap(b, source)
+	lines := ymlItemLines(string(b))
+	for section, entries := range conf {
+		applies, reason := sectionApplies(section, packageTool)
+		for i, e := range entries {
+			for _, r := range e.requirements(sectionTool(section, packageTool, applies), source) {
+				r.Section = section
+				r.Line = nthLine(lines[section], i)
+				if ref, ok := explainRequirement(r, name, packageTool, applies, reason); ok {
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].Line < refs[j].Line })
+	return refs
+}
+
+func explainText(text, source, section, name, packageTool string, applies bool, reason string) (refs []Reference) {
+	for _, r := range parseRequirementsText(text, sectionTool(section, packageTool, applies), source) {
+		r.Section = section
+		if ref, ok := explainRequirement(r, name, packageTool, applies, reason); ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// the tool installing the packages of section, packageTool for the
+// system sections it installs
+func sectionTool(section, packageTool string, applies bool) string {
+	switch {
+	case section == "common", applies && StringInSlice(section, systemSections):
+		return packageTool
+	case section == "taps" || section == "casks":
+		return "brew"
+	}
+	return section
+}
+
+// whether packageTool's installs install the packages of section and why
+func sectionApplies(section, packageTool string) (bool, string) {
+	system := emulatedTool(packageTool)
+	switch {
+	case section == "common":
+		return true, "common packages are installed with every system package tool"
+	case section == system:
+		return true, "the " + section + " section is installed on " + system + " systems"
+	case StringInSlice(section, systemSections):
+		return false, "the " + section + " section is only installed on " + section + " systems, this one uses " + system
+	case section == "pip" || section == "pip3" || section == "npm":
+		return true, section + " packages are installed by the " + section + " step"
+	case section == "taps" || section == "casks":
+		return false, section + " are only written to Brewfiles by reqs export brewfile"
+	}
+	return false, "reqs doesn't read " + section + " sections"
+}
+
+// r as a reference when it or one of its alternatives is name
+func explainRequirement(r Requirement, name, packageTool string, applies bool, reason string) (Reference, bool) {
+	for _, spec := range append([]string{r.Spec()}, r.Alternatives...) {
+		if n, _ := splitVersion(spec, r.Tool); !strings.EqualFold(n, name) {
+			continue
+		}
+		if applies && r.Optional {
+			reason += ", optional so it is skipped when " + packageTool + " doesn't have it"
+		}
+		if applies && len(r.Alternatives) > 0 {
+			reason += ", any of " + strings.Join(r.Alternatives, ", ") + " where the first " + packageTool + " has is installed"
+		}
+		return Reference{Requirement: r, Applies: applies, Reason: reason}, true
+	}
+	return Reference{}, false
+}
+
+// write each reference with where it is, whether it applies and whether
+// it is installed, or the references as a json or yaml list
+func PrintReferences(w io.Writer, format string, refs []Reference) error {
+	if format != FormatText && format != "" {
+		if refs == nil {
+			refs = []Reference{}
+		}
+		return encode(w, format, refs)
+	}
+	var lines []string
+	for _, ref := range refs {
+		where := DefaultDiscovery.Origin(ref.Source)
+		if ref.Line > 0 {
+			where += ":" + strconv.Itoa(ref.Line)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s in the %s section", where, ref.Spec(), ref.Section))
+		used := "not used"
+		if ref.Applies {
+			used = "used"
+		}
+		lines = append(lines, "  "+used+", "+ref.Reason)
+		switch ref.Status {
+		case StatusInstalled:
+			installed := "  installed with " + ref.Tool
+			if ref.Installed != "" {
+				installed += ", version " + ref.Installed
+			}
+			lines = append(lines, installed)
+		case StatusMissing:
+			lines = append(lines, "  not installed with "+ref.Tool)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
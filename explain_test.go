@@ -0,0 +1,54 @@
+package reqs
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml":                 "common:\n  - curl\napt:\n  - any-of: [fd-find, fd]\ndnf:\n  - optional: fd\npip:\n  - Flask==1.0\n",
+		"brew-requirements.txt":    "fd\n",
+		"service/requirements.txt": "flask\n",
+	})
+	defer os.RemoveAll(dir)
+	installed := Snapshot{"apt": {Versions: map[string]string{"fd-find": "7.4.0"}}}
+
+	rp := RequirementsParser{Dir: dir, Recurse: true}
+	refs := rp.Explain("fd", "apt", installed)
+	if assert.Len(t, refs, 3) {
+		assert.Equal(t, filepath.Join(dir, "brew-requirements.txt"), refs[0].Source)
+		assert.False(t, refs[0].Applies)
+		assert.Equal(t, "the brew section is only installed on brew systems, this one uses apt", refs[0].Reason)
+
+		assert.Equal(t, "apt", refs[1].Section)
+		assert.Equal(t, 4, refs[1].Line)
+		assert.True(t, refs[1].Applies)
+		assert.Equal(t, "the apt section is installed on apt systems, any of fd-find, fd where the first apt has is installed", refs[1].Reason)
+		assert.Equal(t, StatusInstalled, refs[1].Status)
+		assert.Equal(t, "7.4.0", refs[1].Installed)
+
+		assert.Equal(t, "dnf", refs[2].Section)
+		assert.True(t, refs[2].Optional)
+		assert.False(t, refs[2].Applies)
+		// installed dnf packages are unknown on apt systems
+		assert.Empty(t, refs[2].Status)
+	}
+
+	refs = rp.Explain("flask", "apt", installed)
+	if assert.Len(t, refs, 2) {
+		assert.Equal(t, "1.0", refs[0].Version)
+		assert.Equal(t, "pip packages are installed by the pip step", refs[0].Reason)
+		assert.Equal(t, "requirements.txt files are installed by the pip and pip3 steps", refs[1].Reason)
+	}
+
+	var out bytes.Buffer
+	assert.Nil(t, PrintReferences(&out, FormatText, rp.Explain("curl", "apt", installed)))
+	assert.Equal(t, filepath.Join(dir, "reqs.yml")+`:2: curl in the common section
+  used, common packages are installed with every system package tool
+  not installed with apt
+`, out.String())
+}
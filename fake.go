@@ -0,0 +1,91 @@
+package reqs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// a Runner that runs nothing, it records every command and answers with
+// scripted output so parsing and install flows can be tested anywhere
+
+type FakeResult struct {
+	Stdout, Stderr string
+	ExitCode       int
+	// block until the context is done, like a hung install
+	Hang bool
+	// answer only the first Times runs, after which the command falls
+	// back to a shorter key or runs unscripted, zero answers every run
+	Times int
+}
+
+type FakeRunner struct {
+	// results keyed by command line, a key also matches any command line
+	// it is a prefix of, the longest match wins, unscripted commands
+	// succeed without output
+	Results map[string]FakeResult
+	// executables LookPath finds
+	Commands []string
+	// the commands run so far, in order
+	Calls []Command
+	// runs answered by each key
+	answered map[string]int
+}
+
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{Results: make(map[string]FakeResult)}
+}
+
+func (f *FakeRunner) Run(ctx context.Context, c Command) ([]byte, error) {
+	if ctx.Err() != nil {
+		return nil, interrupted(ctx, c)
+	}
+	f.Calls = append(f.Calls, c)
+	line := c.String()
+	match := ""
+	found := false
+	for key, res := range f.Results {
+		if res.Times > 0 && f.answered[key] >= res.Times {
+			continue
+		}
+		if (line == key || strings.HasPrefix(line, key+" ")) && len(key) >= len(match) {
+			match = key
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	res := f.Results[match]
+	if f.answered == nil {
+		f.answered = make(map[string]int)
+	}
+	f.answered[match]++
+	if c.Stdout != nil {
+		io.WriteString(c.Stdout, res.Stdout)
+	}
+	if res.Hang {
+		<-ctx.Done()
+		return nil, interrupted(ctx, c)
+	}
+	if res.ExitCode != 0 {
+		return []byte(res.Stdout), &ExitError{Command: c, ExitCode: res.ExitCode, Stderr: res.Stderr}
+	}
+	return []byte(res.Stdout), nil
+}
+
+func (f *FakeRunner) LookPath(name string) (string, error) {
+	if StringInSlice(name, f.Commands) {
+		return "/usr/bin/" + name, nil
+	}
+	return "", errors.New("executable file not found: " + name)
+}
+
+// the command lines run so far
+func (f *FakeRunner) CommandLines() (lines []string) {
+	for _, c := range f.Calls {
+		lines = append(lines, c.String())
+	}
+	return lines
+}
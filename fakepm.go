@@ -0,0 +1,49 @@
+package reqs
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// fakepm is a package tool that only exists for tests, see cmd/fakepm.
+// It keeps installed packages in a json state file and behaves like apt,
+// or like dnf, yum or brew when FAKEPM_FLAVOR names one, installing the
+// requirements that tool would.  reqs installs with it instead of the
+// detected tool with -tool fakepm or when REQS_FAKE_PM is set
+
+const FakeTool = "fakepm"
+
+// whether REQS_FAKE_PM asks for fakepm in place of the system's tool
+func FakeToolEnabled() bool {
+	return os.Getenv("REQS_FAKE_PM") != ""
+}
+
+// the tool fakepm emulates, apt unless FAKEPM_FLAVOR is dnf, yum or brew
+func FakepmFlavor() string {
+	switch flavor := os.Getenv("FAKEPM_FLAVOR"); flavor {
+	case "dnf", "yum", "brew":
+		return flavor
+	}
+	return "apt"
+}
+
+// the tool whose requirements, package names and prerequisites tool uses
+func emulatedTool(tool string) string {
+	if tool == FakeTool {
+		return FakepmFlavor()
+	}
+	return tool
+}
+
+func FakepmListInstalled(ctx context.Context, withVersion bool) string {
+	out, err := commandOutput(ctx, FakeTool, "list", "installed")
+	FatalCheck(err)
+	switch FakepmFlavor() {
+	case "dnf", "yum":
+		return parseDnfList(string(out), withVersion)
+	case "brew":
+		return strings.TrimSpace(string(out))
+	}
+	return parseAptList(string(out), withVersion)
+}
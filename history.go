@@ -0,0 +1,375 @@
+package reqs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// every install is recorded as a transaction in a local history, with
+// the packages it installed or upgraded so it can be rolled back later
+
+type Transaction struct {
+	ID   int       `json:"id" yaml:"id"`
+	Time time.Time `json:"time" yaml:"time"`
+	// the package tool installing system requirements
+	Tool string `json:"tool" yaml:"tool"`
+	// the requirements files installed from
+	Sources []string `json:"sources,omitempty" yaml:"sources,omitempty"`
+	// the install commands run, as command lines
+	Commands []string        `json:"commands,omitempty" yaml:"commands,omitempty"`
+	Changes  []PackageChange `json:"changes,omitempty" yaml:"changes,omitempty"`
+	// ids of the transactions dnf or yum recorded in their own history
+	ToolHistory []int `json:"tool_history,omitempty" yaml:"tool_history,omitempty"`
+	// the transaction this one rolled back
+	RollbackOf int `json:"rollback_of,omitempty" yaml:"rollback_of,omitempty"`
+}
+
+// a package a transaction installed, upgraded or removed, Before is
+// empty for installs and After for removals
+type PackageChange struct {
+	Tool string `json:"tool" yaml:"tool"`
+	// the executable for pip, pip3 and npm
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	Sudo    bool   `json:"sudo,omitempty" yaml:"sudo,omitempty"`
+	Name    string `json:"package" yaml:"package"`
+	Before  string `json:"before,omitempty" yaml:"before,omitempty"`
+	After   string `json:"after,omitempty" yaml:"after,omitempty"`
+	// new or gone altogether, brew lists no versions to go by
+	Installed bool `json:"installed,omitempty" yaml:"installed,omitempty"`
+	Removed   bool `json:"removed,omitempty" yaml:"removed,omitempty"`
+}
+
+func (c PackageChange) String() string {
+	switch {
+	case c.Installed:
+		return c.Tool + " installed " + withVersion(c.Name, c.After)
+	case c.Removed:
+		return c.Tool + " removed " + withVersion(c.Name, c.Before)
+	}
+	return c.Tool + " changed " + c.Name + " " + c.Before + " -> " + c.After
+}
+
+func withVersion(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + " " + version
+}
+
+// a line summing up tx for reqs history
+func (tx Transaction) Summary() string {
+	var installed, changed, removed int
+	for _, c := range tx.Changes {
+		switch {
+		case c.Installed:
+			installed++
+		case c.Removed:
+			removed++
+		default:
+			changed++
+		}
+	}
+	summary := strconv.Itoa(installed) + " installed, " + strconv.Itoa(changed) + " changed, " + strconv.Itoa(removed) + " removed"
+	if tx.RollbackOf != 0 {
+		summary += ", rollback of " + strconv.Itoa(tx.RollbackOf)
+	}
+	return summary
+}
+
+type transactionKey struct{}
+
+// a ctx recording the install commands run with it into tx
+func WithTransaction(ctx context.Context, tx *Transaction) context.Context {
+	return context.WithValue(ctx, transactionKey{}, tx)
+}
+
+func recordCommand(ctx context.Context, c Command) {
+	if tx, ok := ctx.Value(transactionKey{}).(*Transaction); ok {
+		tx.Commands = append(tx.Commands, c.String())
+	}
+}
+
+// the packages one tool had installed at some point
+type installedSet struct {
+	Command  string
+	Sudo     bool
+	Versions map[string]string
+}
+
+// the installed packages of each tool reqs installs with, taken before
+// and after a transaction to find what it changed
+type Snapshot map[string]installedSet
+
+// the version of name tool has installed, pip freeze writes names as they
+// were published and dnf and yum list them as name.arch
+func (s Snapshot) Version(tool, name string) (string, bool) {
+	for installed, version := range s[tool].Versions {
+		if i := strings.LastIndex(installed, "."); i > 0 && (emulatedTool(tool) == "dnf" || emulatedTool(tool) == "yum") {
+			installed = installed[:i]
+		}
+		if strings.EqualFold(installed, name) {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// record what tool has installed, command is the executable of pip, pip3
+// and npm, which are left out while command isn't available
+func (s Snapshot) Add(ctx context.Context, tool, command string, sudo bool) error {
+	set := installedSet{Command: command, Sudo: sudo, Versions: make(map[string]string)}
+	switch tool {
+	case "pip", "pip3":
+		if !IsCommandAvailable(command) {
+			return nil
+		}
+		out, err := commandOutput(ctx, command, "freeze")
+		if err != nil {
+			return err
+		}
+		for _, r := range parseRequirementsText(string(out), tool, "") {
+			set.Versions[r.Name] = r.Version
+		}
+	case "npm":
+		if !IsCommandAvailable(command) {
+			return nil
+		}
+		out, err := commandOutput(ctx, command, "ls", "-g", "--depth=0", "--json")
+		if _, ok := err.(*ExitError); err != nil && (!ok || len(out) == 0) {
+			// npm ls exits 1 on problems with the tree but still lists it
+			return err
+		}
+		var listing struct {
+			Dependencies map[string]struct {
+				Version string `json:"version"`
+			} `json:"dependencies"`
+		}
+		if err := json.Unmarshal(out, &listing); err != nil {
+			return err
+		}
+		for name, dep := range listing.Dependencies {
+			set.Versions[name] = dep.Version
+		}
+	default:
+		rp := RequirementsParser{WithVersion: true}
+		for _, r := range parseRequirementsText(rp.ListInstalled(ctx, tool), tool, "") {
+			set.Versions[r.Name] = r.Version
+		}
+	}
+	s[tool] = set
+	return nil
+}
+
+// record the changes between before and after in tx, tools missing from
+// either snapshot are left out
+func (tx *Transaction) Record(before, after Snapshot) {
+	for _, tool := range sortedTools(after) {
+		prev, ok := before[tool]
+		if !ok {
+			continue
+		}
+		set := after[tool]
+		change := PackageChange{Tool: tool, Command: set.Command, Sudo: set.Sudo}
+		if tool == tx.Tool {
+			change.Command, change.Sudo = "", false
+		}
+		for _, name := range sortedNames(set.Versions) {
+			c := change
+			c.Name, c.After = name, set.Versions[name]
+			version, had := prev.Versions[name]
+			switch {
+			case !had:
+				c.Installed = true
+			case version != c.After:
+				c.Before = version
+			default:
+				continue
+			}
+			tx.Changes = append(tx.Changes, c)
+		}
+		for _, name := range sortedNames(prev.Versions) {
+			if _, has := set.Versions[name]; !has {
+				c := change
+				c.Name, c.Before, c.Removed = name, prev.Versions[name], true
+				tx.Changes = append(tx.Changes, c)
+			}
+		}
+	}
+}
+
+func sortedTools(s Snapshot) (tools []string) {
+	for tool := range s {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	return tools
+}
+
+func sortedNames(m map[string]string) (names []string) {
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// the id of the latest transaction in the history of dnf or yum, zero
+// for other tools
+func (pc PackageConfig) ToolHistoryID(ctx context.Context) int {
+	if pc.Tool != "dnf" && pc.Tool != "yum" {
+		return 0
+	}
+	out, err := DefaultRunner.Run(ctx, Command{Argv: append(pc.toolArgv(), "history", "list")})
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if id, err := strconv.Atoi(fields[0]); err == nil {
+			return id
+		}
+	}
+	return 0
+}
+
+// the history file, $XDG_STATE_HOME/reqs/history.jsonl, by default in
+// ~/.local/state
+var DefaultHistoryPath = defaultHistoryPath()
+
+func defaultHistoryPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "reqs", "history.jsonl")
+}
+
+// the transactions recorded at path, oldest first, none when it doesn't
+// exist yet
+func LoadHistory(path string) (history []Transaction, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var tx Transaction
+		if err := json.Unmarshal(scanner.Bytes(), &tx); err != nil {
+			return nil, errors.New(path + ":" + strconv.Itoa(line) + ": " + err.Error())
+		}
+		history = append(history, tx)
+	}
+	return history, scanner.Err()
+}
+
+// append tx to the history at path with the next id
+func SaveTransaction(path string, tx *Transaction) error {
+	history, err := LoadHistory(path)
+	if err != nil {
+		return err
+	}
+	tx.ID = 1
+	if len(history) > 0 {
+		tx.ID = history[len(history)-1].ID + 1
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// the transaction with id, and whether a later one rolled it back
+func FindTransaction(history []Transaction, id int) (tx Transaction, rolledBack bool, err error) {
+	found := false
+	for _, t := range history {
+		if t.ID == id {
+			tx, found = t, true
+		}
+		if t.RollbackOf == id {
+			rolledBack = true
+		}
+	}
+	if !found {
+		return tx, false, errors.New("no transaction " + strconv.Itoa(id) + " in the history")
+	}
+	return tx, rolledBack, nil
+}
+
+// write the history as a table, one transaction a line
+func PrintHistory(w io.Writer, format string, history []Transaction) error {
+	if format != FormatText && format != "" {
+		return encode(w, format, history)
+	}
+	for _, tx := range history {
+		_, err := io.WriteString(w, strconv.Itoa(tx.ID)+"\t"+tx.Time.Local().Format("2006-01-02 15:04")+"\t"+tx.Tool+"\t"+tx.Summary()+"\t"+strings.Join(tx.Sources, ", ")+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write everything about one transaction
+func PrintTransaction(w io.Writer, format string, tx Transaction) error {
+	if format != FormatText && format != "" {
+		return encode(w, format, tx)
+	}
+	lines := []string{
+		"Transaction " + strconv.Itoa(tx.ID) + " at " + tx.Time.Local().Format(time.RFC1123),
+		"Tool: " + tx.Tool,
+		"Summary: " + tx.Summary(),
+	}
+	if len(tx.Sources) > 0 {
+		lines = append(lines, "Sources: "+strings.Join(tx.Sources, ", "))
+	}
+	if len(tx.Commands) > 0 {
+		lines = append(lines, "Commands:")
+		for _, c := range tx.Commands {
+			lines = append(lines, "  "+c)
+		}
+	}
+	if len(tx.Changes) > 0 {
+		lines = append(lines, "Changes:")
+		for _, c := range tx.Changes {
+			lines = append(lines, "  "+c.String())
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
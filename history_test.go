@@ -0,0 +1,81 @@
+package reqs
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransactionRecord(t *testing.T) {
+	before := Snapshot{
+		"apt": {Command: "apt", Versions: map[string]string{"git": "1:2.17.1", "curl": "7.58.0", "vim": "8.0"}},
+		"pip": {Command: "pip", Sudo: true, Versions: map[string]string{"flask": "0.12"}},
+	}
+	after := Snapshot{
+		"apt": {Command: "apt", Versions: map[string]string{"git": "1:2.20.1", "curl": "7.58.0", "zsh": "5.4.2"}},
+		"pip": {Command: "pip", Sudo: true, Versions: map[string]string{"flask": "0.12", "six": "1.11.0"}},
+		// not in before, pip3 wasn't available yet
+		"pip3": {Command: "pip3", Versions: map[string]string{"pywal": "3.0.0"}},
+	}
+	tx := Transaction{Tool: "apt"}
+	tx.Record(before, after)
+	assert.Equal(t, []PackageChange{
+		{Tool: "apt", Name: "git", Before: "1:2.17.1", After: "1:2.20.1"},
+		{Tool: "apt", Name: "zsh", After: "5.4.2", Installed: true},
+		{Tool: "apt", Name: "vim", Before: "8.0", Removed: true},
+		{Tool: "pip", Command: "pip", Sudo: true, Name: "six", After: "1.11.0", Installed: true},
+	}, tx.Changes)
+	assert.Equal(t, "1 installed, 1 changed, 1 removed", Transaction{Changes: tx.Changes[:3]}.Summary())
+}
+
+func TestSaveTransaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reqs", "history.jsonl")
+	history, err := LoadHistory(path)
+	assert.Nil(t, err)
+	assert.Empty(t, history)
+
+	first := &Transaction{Tool: "apt", Commands: []string{"apt install -y git"}}
+	assert.Nil(t, SaveTransaction(path, first))
+	second := &Transaction{Tool: "apt", RollbackOf: 1}
+	assert.Nil(t, SaveTransaction(path, second))
+	assert.Equal(t, 2, second.ID)
+
+	history, err = LoadHistory(path)
+	assert.Nil(t, err)
+	tx, rolledBack, err := FindTransaction(history, 1)
+	assert.Nil(t, err)
+	assert.True(t, rolledBack)
+	assert.Equal(t, []string{"apt install -y git"}, tx.Commands)
+	_, _, err = FindTransaction(history, 3)
+	assert.EqualError(t, err, "no transaction 3 in the history")
+}
+
+func TestRollback(t *testing.T) {
+	fake := useFakeRunner(t)
+	tx := Transaction{ID: 4, Tool: "apt", Changes: []PackageChange{
+		{Tool: "apt", Name: "zsh", After: "5.4.2", Installed: true},
+		{Tool: "apt", Name: "git", Before: "1:2.17.1-1ubuntu0.4~18.04", After: "1:2.20.1"},
+		{Tool: "apt", Name: "vim", Before: "8.0", Removed: true},
+		{Tool: "pip", Command: "pip2", Sudo: true, Name: "six", After: "1.11.0", Installed: true},
+		{Tool: "npm", Command: "npm", Name: "bower", Before: "1.8.2", After: "1.8.4"},
+	}}
+	pc := PackageConfig{Tool: "apt", Sudo: "sudo", AutoYes: "-y", Quiet: true}
+	skipped, err := pc.Rollback(context.Background(), tx)
+	assert.Nil(t, err)
+	assert.Equal(t, []PackageChange{tx.Changes[2]}, skipped)
+	assert.Equal(t, []string{
+		"npm install -g bower@1.8.2",
+		"sudo pip2 uninstall -y six",
+		"sudo apt remove -y zsh",
+		"sudo apt install -y --allow-downgrades git=1:2.17.1-1ubuntu0.4~18.04",
+	}, fake.CommandLines())
+
+	// dnf undoes its own transactions
+	fake.Calls = nil
+	tx = Transaction{Tool: "dnf", ToolHistory: []int{11, 12}, Changes: []PackageChange{{Tool: "dnf", Name: "git.x86_64", After: "2.17.1", Installed: true}}}
+	pc = PackageConfig{Tool: "dnf", AutoYes: "-y", Quiet: true}
+	_, err = pc.Rollback(context.Background(), tx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dnf history undo -y 12", "dnf history undo -y 11"}, fake.CommandLines())
+}
@@ -0,0 +1,254 @@
+package reqs
+
+import (
+	"errors"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// reqs.yml files can include other requirements files so services can
+// share a base set of dependencies
+//
+//  include:
+//    - ../base/reqs.yml
+//    - ../base/apt-requirements.txt
+//    - ../shared
+//
+// Paths are relative to the including file.  A directory includes the
+// requirements files directly in it, included reqs.yml files are
+// expanded in turn and each file is read once however often it's included.
+// Remote files are fetched with their pin, see remote.go
+//
+//  include:
+//    - url: https://platform.example.com/reqs.yml
+//      sha256: 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+//    - url: git+https://github.com/example/baseline.git@v1#base/reqs.yml
+//      commit: 4b825dc642cb6eb9a060e54bf8d69288fbee4904
+
+const includeKey = "include"
+
+// a reqs.yml includes itself through the files in Chain
+type IncludeCycleError struct {
+	Chain []string
+}
+
+func (e *IncludeCycleError) Error() string {
+	return "include cycle " + strings.Join(e.Chain, " -> ")
+}
+
+// an include entry, a local path or a pinned remote file
+type includeEntry struct {
+	Path string
+	// http(s) URL or git+ URL of a repository, @ref and #path in it
+	URL string
+	// the sha256 of a file fetched over http(s)
+	SHA256 string
+	// the commit a git ref must be at
+	Commit string
+}
+
+// a path or url string, or a mapping of a url to its sha256 or commit
+func (e *includeEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		if isRemoteInclude(s) {
+			e.URL = s
+		} else {
+			e.Path = s
+		}
+		return nil
+	}
+	// strings keep pins of only digits as written
+	var m map[string]string
+	if err := unmarshal(&m); err != nil {
+		return errors.New("include entries must be a path or url, or a url with its sha256 or commit")
+	}
+	for key, value := range m {
+		switch key {
+		case "url":
+			e.URL = value
+		case "sha256":
+			e.SHA256 = strings.ToLower(value)
+		case "commit":
+			e.Commit = strings.ToLower(value)
+		default:
+			return errors.New("unknown include key " + key + ", expected url, sha256 or commit")
+		}
+	}
+	if e.URL == "" {
+		return errors.New("include of a remote file needs its url")
+	}
+	return nil
+}
+
+func isRemoteInclude(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "git+")
+}
+
+func (e includeEntry) String() string {
+	if e.URL != "" {
+		return e.URL
+	}
+	return e.Path
+}
+
+// the requirements files an include entry of the file from names
+func (d *Discovery) resolveInclude(from string, e includeEntry) ([]RequirementsFile, error) {
+	var path string
+	switch {
+	case e.URL != "":
+		var err error
+		if path, err = d.fetchInclude(d.context(), e); err != nil {
+			return nil, errors.New(from + ": can't include " + e.URL + ", " + err.Error())
+		}
+	case strings.TrimSpace(e.Path) == "":
+		return nil, errors.New(from + ": include entries must be paths")
+	case filepath.IsAbs(e.Path):
+		path = e.Path
+	default:
+		path = filepath.Join(filepath.Dir(from), e.Path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.New(from + ": can't include " + e.String() + ", " + err.Error())
+	}
+	var files []RequirementsFile
+	if info.IsDir() {
+		if files, err = d.Find(path, false); err != nil {
+			return nil, err
+		}
+	} else {
+		rf, ok := d.classifyNamed(path)
+		if !ok {
+			return nil, errors.New(from + ": can't include " + e.String() + ", " + filepath.Base(path) + " is not a requirements file name")
+		}
+		files = []RequirementsFile{rf}
+	}
+	// what remote files include comes from their url as well
+	origin := d.origins[absPath(from)]
+	if e.URL != "" {
+		origin = e.URL
+	}
+	if origin != "" {
+		if d.origins == nil {
+			d.origins = make(map[string]string)
+		}
+		for _, rf := range files {
+			if _, ok := d.origins[absPath(rf.Path)]; !ok {
+				d.origins[absPath(rf.Path)] = origin
+			}
+		}
+	}
+	return files, nil
+}
+
+// the url a cached remote include was fetched from, path itself for
+// local files
+func (d *Discovery) Origin(path string) string {
+	if origin, ok := d.origins[absPath(path)]; ok {
+		return origin
+	}
+	return path
+}
+
+// a depth first walk of includes, stack holds the reqs.yml files being
+// expanded to detect cycles
+type includeWalk struct {
+	d *Discovery
+	// the directory signatures are checked relative to
+	root  string
+	seen  map[string]bool
+	stack []RequirementsFile
+	files []RequirementsFile
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+func (w *includeWalk) add(rf RequirementsFile) error {
+	abs := absPath(rf.Path)
+	for i, including := range w.stack {
+		if absPath(including.Path) == abs {
+			var chain []string
+			for _, f := range w.stack[i:] {
+				chain = append(chain, f.Path)
+			}
+			return &IncludeCycleError{Chain: append(chain, rf.Path)}
+		}
+	}
+	if w.seen[abs] {
+		return nil
+	}
+	w.seen[abs] = true
+	w.files = append(w.files, rf)
+	// checked before its includes are followed
+	if err := w.d.Verify(w.root, []RequirementsFile{rf}); err != nil {
+		return err
+	}
+	if rf.Kind != KindReqsYml {
+		return nil
+	}
+	b, err := w.d.readFile(rf.Path)
+	if err != nil {
+		return err
+	}
+	return w.include(rf, b)
+}
+
+// add the files the reqs.yml document b read from rf includes
+func (w *includeWalk) include(rf RequirementsFile, b []byte) error {
+	var doc struct {
+		Include []includeEntry `yaml:"include"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return errors.New(rf.Path + ": " + err.Error() + ", run reqs lint for details")
+	}
+	entries := doc.Include
+	if len(entries) == 0 {
+		return nil
+	}
+	w.stack = append(w.stack, rf)
+	defer func() { w.stack = w.stack[:len(w.stack)-1] }()
+	for _, e := range entries {
+		files, err := w.d.resolveInclude(rf.Path, e)
+		if err != nil {
+			return err
+		}
+		for _, included := range files {
+			w.d.report("Including " + included.Path + " from " + rf.Path)
+			if err := w.add(included); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// files with what their reqs.yml files include following each of them,
+// every file once, with their signatures checked relative to root when
+// they're required
+func (d *Discovery) Expand(root string, files []RequirementsFile) ([]RequirementsFile, error) {
+	w := includeWalk{d: d, root: root, seen: make(map[string]bool)}
+	for _, rf := range files {
+		if err := w.add(rf); err != nil {
+			return nil, err
+		}
+	}
+	return w.files, nil
+}
+
+// the files the reqs.yml document b includes, recursively, source is
+// where b was read from and includes are relative to it
+func (d *Discovery) Included(root, source string, b []byte) ([]RequirementsFile, error) {
+	w := includeWalk{d: d, root: root, seen: map[string]bool{absPath(source): true}}
+	if err := w.include(RequirementsFile{Path: source, Kind: KindReqsYml}, b); err != nil {
+		return nil, err
+	}
+	return w.files, nil
+}
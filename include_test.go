@@ -0,0 +1,80 @@
+package reqs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInclude(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"base/reqs.yml":               "common:\n  - git\npip:\n  - flask\n",
+		"base/apt-requirements.txt":   "curl\n",
+		"shared/reqs.yml":             "include:\n  - ../base/reqs.yml\napt:\n  - vim\n",
+		"shared/npm-requirements.txt": "left-pad\n",
+		"service/reqs.yml":            "include:\n  - ../base/apt-requirements.txt\n  - ../shared\napt:\n  - htop\n",
+	})
+	defer os.RemoveAll(dir)
+	service := filepath.Join(dir, "service")
+
+	var names []string
+	for _, r := range findSysRequirements(service, "apt", false) {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"htop", "curl", "vim", "git"}, names)
+	assert.Equal(t, "flask", GetPipRequirements(service, false))
+	assert.Equal(t, "left-pad", GetNpmRequirements(service, false))
+
+	// included by both, read once
+	files, err := DefaultDiscovery.Expand(dir, []RequirementsFile{
+		{Path: filepath.Join(dir, "shared", "reqs.yml"), Kind: KindReqsYml},
+		{Path: filepath.Join(service, "reqs.yml"), Kind: KindReqsYml},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, files, 5)
+
+	rp := RequirementsParser{File: filepath.Join(service, "reqs.yml")}
+	assert.Equal(t, "flask", rp.ParsePip())
+	assert.Equal(t, "left-pad", rp.ParseNpm())
+	assert.True(t, rp.YmlSections()["pip"])
+}
+
+func TestIncludeSectionSkipped(t *testing.T) {
+	b := []byte("include:\n  - url: https://example.com/reqs.yml\n    sha256: " + strings.Repeat("0", 64) + "\napt:\n  - git\n")
+	assert.Equal(t, map[string][]ymlEntry{"apt": {{Packages: "git"}}}, ymlBytesToMap(b, "reqs.yml"))
+}
+
+func TestIncludeErrors(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"a/reqs.yml":    "include:\n  - ../b\n",
+		"b/reqs.yml":    "include:\n  - ../a/reqs.yml\n",
+		"c/reqs.yml":    "include:\n  - notes.txt\n  - missing\n",
+		"c/notes.txt":   "",
+		"self/reqs.yml": "include:\n  - reqs.yml\n",
+	})
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a", "reqs.yml")
+	b := filepath.Join(dir, "b", "reqs.yml")
+
+	_, err := DefaultDiscovery.Expand(dir, []RequirementsFile{{Path: a, Kind: KindReqsYml}})
+	assert.Equal(t, &IncludeCycleError{Chain: []string{a, b, a}}, err)
+
+	self := filepath.Join(dir, "self", "reqs.yml")
+	_, err = DefaultDiscovery.Expand(dir, []RequirementsFile{{Path: self, Kind: KindReqsYml}})
+	assert.Equal(t, &IncludeCycleError{Chain: []string{self, self}}, err)
+
+	var got []string
+	for _, d := range LintDir(dir, true) {
+		got = append(got, d.String())
+	}
+	c := filepath.Join(dir, "c", "reqs.yml")
+	assert.Equal(t, []string{
+		a + ":1: include cycle " + a + " -> " + b + " -> " + a,
+		b + ":1: include cycle " + b + " -> " + a + " -> " + b,
+		c + ":2: can't include notes.txt, notes.txt is not a requirements file name",
+		c + ":3: can't include missing, stat " + filepath.Join(dir, "c", "missing") + ": no such file or directory",
+		self + ":1: include cycle " + self + " -> " + self,
+	}, got)
+}
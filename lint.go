@@ -0,0 +1,442 @@
+package reqs
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// checks reqs.yml and requirements files for mistakes reqs would
+// otherwise silently ignore or fail on at install time
+
+// sections reqs.yml files may contain
+var knownSections = []string{
+	"common",
+	"apt",
+	"brew",
+	"dnf",
+	"yum",
+	"pip",
+	"pip3",
+	"npm",
+	"taps",
+	"casks",
+}
+
+// sections whose entries are system packages that may also be in common
+var systemSections = []string{"apt", "brew", "dnf", "yum"}
+
+type Diagnostic struct {
+	File    string
+	Line    int
+	Message string
+	// worth a look but not a mistake, lint still passes
+	Warning bool
+}
+
+func (d Diagnostic) String() string {
+	msg := d.Message
+	if d.Warning {
+		msg = "warning: " + msg
+	}
+	if d.Line > 0 {
+		return d.File + ":" + strconv.Itoa(d.Line) + ": " + msg
+	}
+	return d.File + ": " + msg
+}
+
+// whether any of diags is a mistake rather than a warning
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if !d.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+var yamlErrLine = regexp.MustCompile(`line (\d+)`)
+
+// lint every requirements file found in the directory
+func LintDir(dirPath string, recurse bool) (diags []Diagnostic) {
+	// without following includes, lintYml reports the ones that are broken
+	files, err := DefaultDiscovery.Find(dirPath, recurse)
+	FatalCheck(err)
+	for _, rf := range files {
+		diags = append(diags, lintRequirementsFile(rf)...)
+	}
+	return diags
+}
+
+// lint a reqs.yml or requirements file, other .yml and .yaml files are
+// linted as reqs.yml and anything else is ignored
+func LintFile(path string) []Diagnostic {
+	rf, ok := DefaultDiscovery.classifyNamed(path)
+	if !ok {
+		return nil
+	}
+	return lintRequirementsFile(rf)
+}
+
+func lintRequirementsFile(rf RequirementsFile) []Diagnostic {
+	switch rf.Kind {
+	case KindReqsYml:
+		return lintYml(rf.Path)
+	case KindPipRequirements, KindPipDarwinRequirements:
+		return lintRequirementsTxt(rf.Path, "pip")
+	case KindToolRequirements:
+		if StringInSlice(rf.Tool, knownSections) {
+			return lintRequirementsTxt(rf.Path, rf.Tool)
+		}
+	}
+	return nil
+}
+
+func lintYml(path string) (diags []Diagnostic) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []Diagnostic{{File: path, Message: err.Error()}}
+	}
+	conf := make(map[string]interface{})
+	if err := yaml.Unmarshal(b, &conf); err != nil {
+		line := 0
+		if m := yamlErrLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		msg := strings.TrimPrefix(err.Error(), "yaml: ")
+		msg = strings.TrimPrefix(msg, "line "+strconv.Itoa(line)+": ")
+		return []Diagnostic{{File: path, Line: line, Message: "invalid yaml: " + msg}}
+	}
+
+	lines := ymlItemLines(string(b))
+	sectionLines := ymlSectionLines(string(b))
+	common := make(map[string]bool)
+	for _, e := range ymlStringEntries(conf["common"]) {
+		for _, name := range strings.Fields(e) {
+			common[name] = true
+		}
+	}
+	for _, section := range sectionsInOrder(conf, sectionLines) {
+		line := sectionLines[section]
+		if section == includeKey {
+			diags = append(diags, lintInclude(path, b, conf[section], line)...)
+			continue
+		}
+		if !StringInSlice(section, knownSections) {
+			msg := "unknown section " + section
+			if suggestion := closestString(section, knownSections); suggestion != "" {
+				msg += ", did you mean " + suggestion + "?"
+			}
+			diags = append(diags, Diagnostic{File: path, Line: line, Message: msg})
+			continue
+		}
+		entries, ok := conf[section].([]interface{})
+		if !ok {
+			diags = append(diags, Diagnostic{File: path, Line: line, Message: "section " + section + " must be a list of package names"})
+			continue
+		}
+		seen := make(map[string]bool)
+		for i, e := range entries {
+			entryLine := nthLine(lines[section], i)
+			if entryLine == 0 {
+				entryLine = line
+			}
+			var entry ymlEntry
+			// what lintEntry checks, the whole line for plain entries
+			var checked []string
+			switch v := e.(type) {
+			case string:
+				entry.Packages = v
+				checked = []string{v}
+			case map[interface{}]interface{}:
+				var msgs []string
+				if entry, msgs = lintMapEntry(v, section); len(msgs) > 0 {
+					for _, msg := range msgs {
+						diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: msg})
+					}
+					continue
+				}
+				checked = entry.AnyOf
+				if entry.Optional {
+					checked = []string{entry.Packages}
+				}
+			default:
+				diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: fmt.Sprintf("entry %v in %s is not a package name", e, section)})
+				continue
+			}
+			var names []string
+			for _, c := range checked {
+				msgs, warnings := lintEntry(c, section)
+				for _, msg := range msgs {
+					diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: msg})
+				}
+				for _, msg := range warnings {
+					diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: msg, Warning: true})
+				}
+				names = append(names, strings.Fields(c)...)
+			}
+			for _, name := range names {
+				if seen[name] {
+					diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: "duplicate entry " + name + " in " + section})
+				} else if common[name] && StringInSlice(section, systemSections) {
+					diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: "duplicate entry " + name + " in " + section + ", already in common"})
+				}
+				seen[name] = true
+			}
+		}
+	}
+	return diags
+}
+
+// include entries must name requirements files or directories, remote
+// ones must be pinned, and they must not lead back to the including file
+func lintInclude(path string, b []byte, include interface{}, line int) (diags []Diagnostic) {
+	if _, ok := include.([]interface{}); !ok {
+		return []Diagnostic{{File: path, Line: line, Message: "section include must be a list of paths or urls"}}
+	}
+	// decoded again for each entry's error
+	var doc struct {
+		Include []lintedInclude `yaml:"include"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return []Diagnostic{{File: path, Line: line, Message: err.Error()}}
+	}
+	lines := ymlItemLines(string(b))
+	for i, linted := range doc.Include {
+		e := linted.entry
+		entryLine := nthLine(lines[includeKey], i)
+		if entryLine == 0 {
+			entryLine = line
+		}
+		if linted.err != nil {
+			diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: linted.err.Error()})
+			continue
+		}
+		if e.URL != "" {
+			// checked without fetching anything
+			if err := e.checkPin(); err != nil {
+				diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: "include " + e.URL + ": " + err.Error()})
+			}
+			continue
+		}
+		if _, err := DefaultDiscovery.resolveInclude(path, e); err != nil {
+			diags = append(diags, Diagnostic{File: path, Line: entryLine, Message: strings.TrimPrefix(err.Error(), path+": ")})
+		}
+	}
+	if len(diags) > 0 {
+		return diags
+	}
+	// cycles through remote includes are found once they are cached
+	offline := *DefaultDiscovery
+	offline.Offline = true
+	if _, err := offline.Included(".", path, b); err != nil {
+		if cycle, ok := err.(*IncludeCycleError); ok {
+			diags = append(diags, Diagnostic{File: path, Line: line, Message: cycle.Error()})
+		}
+	}
+	return diags
+}
+
+type lintedInclude struct {
+	entry includeEntry
+	err   error
+}
+
+func (l *lintedInclude) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	l.err = l.entry.UnmarshalYAML(unmarshal)
+	return nil
+}
+
+func lintRequirementsTxt(path, tool string) (diags []Diagnostic) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []Diagnostic{{File: path, Message: err.Error()}}
+	}
+	seen := make(map[string]int)
+	lines := strings.Split(string(b), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed != strings.TrimRight(line, "\r") {
+			diags = append(diags, Diagnostic{File: path, Line: i + 1, Message: "leading or trailing whitespace in " + trimmed})
+		}
+		lineNo := i + 1
+		if tool == "pip" || tool == "pip3" {
+			// check continued lines as the one line pip reads
+			for strings.HasSuffix(trimmed, "\\") && i+1 < len(lines) {
+				i++
+				trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, "\\")) + " " + strings.TrimSpace(lines[i])
+			}
+		}
+		msgs, warnings := lintEntry(trimmed, tool)
+		for _, msg := range msgs {
+			diags = append(diags, Diagnostic{File: path, Line: lineNo, Message: msg})
+		}
+		for _, msg := range warnings {
+			diags = append(diags, Diagnostic{File: path, Line: lineNo, Message: msg, Warning: true})
+		}
+		if prev, ok := seen[trimmed]; ok {
+			diags = append(diags, Diagnostic{File: path, Line: lineNo, Message: "duplicate entry " + trimmed + ", already on line " + strconv.Itoa(prev)})
+		} else {
+			seen[trimmed] = lineNo
+		}
+	}
+	return diags
+}
+
+// the entry an optional: or any-of: map stands for and what's wrong with
+// its shape
+func lintMapEntry(m map[interface{}]interface{}, section string) (entry ymlEntry, msgs []string) {
+	if section != "common" && !StringInSlice(section, systemSections) {
+		return entry, []string{"optional and any-of entries are only supported in common and system package sections, not " + section}
+	}
+	if len(m) != 1 {
+		return entry, []string{fmt.Sprintf("entry %v in %s should have a single optional or any-of key", m, section)}
+	}
+	for k, v := range m {
+		key := fmt.Sprint(k)
+		switch key {
+		case "optional":
+			name, ok := v.(string)
+			if !ok {
+				return entry, []string{"optional in " + section + " must be a single package name"}
+			}
+			entry.Packages, entry.Optional = name, true
+		case "any-of":
+			alts := ymlStringEntries(v)
+			if list, _ := v.([]interface{}); len(alts) == 0 || len(alts) != len(list) {
+				return entry, []string{"any-of in " + section + " must be a list of package names"}
+			}
+			entry.AnyOf = alts
+		default:
+			msg := "unknown key " + key + " in " + section
+			if suggestion := closestString(key, []string{"optional", "any-of"}); suggestion != "" {
+				msg += ", did you mean " + suggestion + "?"
+			}
+			return entry, []string{msg}
+		}
+	}
+	return entry, nil
+}
+
+// the string entries of a yml section
+func ymlStringEntries(v interface{}) (entries []string) {
+	list, _ := v.([]interface{})
+	for _, e := range list {
+		if entry, ok := e.(string); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// the sections of a reqs.yml in the order they appear in the file
+func sectionsInOrder(conf map[string]interface{}, sectionLines map[string]int) (sections []string) {
+	for section := range conf {
+		sections = append(sections, section)
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		if sectionLines[sections[i]] != sectionLines[sections[j]] {
+			return sectionLines[sections[i]] < sectionLines[sections[j]]
+		}
+		return sections[i] < sections[j]
+	})
+	return sections
+}
+
+// problems with a single entry of a section, and pip options that install
+// but deserve a second look
+func lintEntry(entry, section string) (msgs, warnings []string) {
+	if strings.ContainsAny(entry, "\t") {
+		msgs = append(msgs, "tab in "+strings.TrimSpace(entry))
+	}
+	switch section {
+	case "pip", "pip3":
+		// pip reads each line itself from a requirements file, install
+		// refuses the lines ValidatePipLine does
+		if err := ValidatePipLine(entry); err != nil {
+			msgs = append(msgs, err.Error())
+		} else if opt, _ := splitPipOption(entry); opt == "--extra-index-url" {
+			warnings = append(warnings, "pip option --extra-index-url lets pip take any package from either index, prefer --index-url")
+		}
+		return msgs, warnings
+	case "npm":
+		if strings.ContainsAny(entry, " \t") {
+			msgs = append(msgs, "whitespace in npm package "+entry)
+		}
+	default:
+		if len(strings.Fields(entry)) > 1 {
+			msgs = append(msgs, "multiple packages on one line: "+entry)
+		}
+	}
+	if len(msgs) == 0 {
+		// install refuses these, so report them before it gets that far
+		for _, name := range strings.Fields(entry) {
+			if err := ValidatePackageName(section, name); err != nil {
+				msgs = append(msgs, err.Error())
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// line numbers of the top level keys of a yml document
+func ymlSectionLines(text string) map[string]int {
+	lines := make(map[string]int)
+	for i, line := range strings.Split(text, "\n") {
+		if line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		key := strings.TrimSpace(strings.SplitN(line, ":", 2)[0])
+		if _, ok := lines[key]; !ok {
+			lines[key] = i + 1
+		}
+	}
+	return lines
+}
+
+// the candidate within edit distance 2 of s, if any
+func closestString(s string, candidates []string) (closest string) {
+	best := 3
+	for _, c := range candidates {
+		if d := editDistance(s, c); d < best {
+			best = d
+			closest = c
+		}
+	}
+	return closest
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,111 @@
+package reqs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLintYml(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml": `common:
+  - git
+  - curl
+dfn:
+  - golang
+apt:
+  - git
+  - python python-pip
+  - vim
+  - vim
+pip:
+  - flask
+  - -r other.txt
+  - requests >= 2.0
+  - pywin32; "win32" == sys_platform
+  - --extra-index-url https://pypi.example.com/simple
+  - --global-option build_ext
+  - -i http://pypi.example.com/simple
+`,
+	})
+	defer os.RemoveAll(dir)
+	yml := filepath.Join(dir, "reqs.yml")
+
+	var got []string
+	for _, d := range LintFile(yml) {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		yml + ":4: unknown section dfn, did you mean dnf?",
+		yml + ":7: duplicate entry git in apt, already in common",
+		yml + ":8: multiple packages on one line: python python-pip",
+		yml + ":10: duplicate entry vim in apt",
+		yml + ":16: warning: pip option --extra-index-url lets pip take any package from either index, prefer --index-url",
+		yml + ":17: pip option '--global-option' is not allowed in requirements",
+		yml + ":18: pip url 'http://pypi.example.com/simple' is not https, git+https or git+ssh",
+	}, got)
+}
+
+func TestLintYmlShape(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml":   "apt: git\n",
+		"a/reqs.yml": "apt:\n  - git\n  bad\n",
+	})
+	defer os.RemoveAll(dir)
+
+	diags := LintFile(filepath.Join(dir, "reqs.yml"))
+	assert.Equal(t, 1, len(diags))
+	assert.Equal(t, "section apt must be a list of package names", diags[0].Message)
+
+	diags = LintFile(filepath.Join(dir, "a", "reqs.yml"))
+	assert.Equal(t, 1, len(diags))
+	assert.True(t, diags[0].Line > 0)
+	assert.Contains(t, diags[0].Message, "invalid yaml")
+}
+
+func TestLintRequirementsTxt(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"apt-requirements.txt": "# comment\ngit\ncurl wget\n git\n",
+	})
+	defer os.RemoveAll(dir)
+	txt := filepath.Join(dir, "apt-requirements.txt")
+
+	var got []string
+	for _, d := range LintDir(dir, false) {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		txt + ":3: multiple packages on one line: curl wget",
+		txt + ":4: leading or trailing whitespace in git",
+		txt + ":4: duplicate entry git, already on line 2",
+	}, got)
+}
+
+func TestLintYmlOptionalAndAnyOf(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml": `apt:
+  - optional: htop
+  - any-of: [fd-find, fd]
+  - optinal: ripgrep
+  - any-of: fd;rm
+  - optional: git
+  - git
+npm:
+  - optional: express
+`,
+	})
+	defer os.RemoveAll(dir)
+	yml := filepath.Join(dir, "reqs.yml")
+
+	var got []string
+	for _, d := range LintFile(yml) {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		yml + ":4: unknown key optinal in apt, did you mean optional?",
+		yml + ":5: any-of in apt must be a list of package names",
+		yml + ":7: duplicate entry git in apt",
+		yml + ":9: optional and any-of entries are only supported in common and system package sections, not npm",
+	}, got)
+}
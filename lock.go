@@ -0,0 +1,235 @@
+package reqs
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// package tools refuse to run while another run holds their lock, e.g.
+// unattended-upgrades on a freshly booted ubuntu.  reqs waits for the
+// lock with backoff instead of failing, and holds a lock of its own so
+// two runs of reqs on one host take turns
+
+// stderr of a tool that couldn't get its lock, the holder is captured
+// as pid and name when the tool says
+var lockPatterns = map[string][]*regexp.Regexp{
+	"apt": {
+		regexp.MustCompile(`Could not get lock \S+?\.? It is held by process (?P<pid>\d+) \((?P<name>[^)]+)\)`),
+		regexp.MustCompile(`Could not get lock `),
+		regexp.MustCompile(`Unable to (?:acquire the dpkg frontend lock|lock the administration directory)`),
+	},
+	"dnf": {
+		regexp.MustCompile(`Waiting for process with pid (?P<pid>\d+) to finish`),
+		regexp.MustCompile(`Failed to obtain the transaction lock`),
+		regexp.MustCompile(`can't create transaction lock`),
+	},
+	"yum": {
+		regexp.MustCompile(`(?s)holding the yum lock.*The other application is: (?P<name>\S+).*pid: (?P<pid>\d+)`),
+		regexp.MustCompile(`holding the yum lock`),
+		regexp.MustCompile(`can't create transaction lock`),
+	},
+	"brew": {
+		regexp.MustCompile(`process has already locked`),
+	},
+}
+
+// the first delay between tries for a lock, doubled each try up to
+// maxLockDelay
+var (
+	lockDelay    = time.Second
+	maxLockDelay = 30 * time.Second
+)
+
+// whether stderr says tool's lock is held, and who holds it
+func lockHolder(tool, stderr string) (holder string, locked bool) {
+	for _, pattern := range lockPatterns[emulatedTool(tool)] {
+		match := pattern.FindStringSubmatch(stderr)
+		if match == nil {
+			continue
+		}
+		var pid, name string
+		for i, group := range pattern.SubexpNames() {
+			switch group {
+			case "pid":
+				pid = match[i]
+			case "name":
+				name = match[i]
+			}
+		}
+		if pid == "" {
+			return "another process", true
+		}
+		holder = "process " + pid
+		if name == "" {
+			name = processName(pid)
+		}
+		if name != "" {
+			holder += " (" + name + ")"
+		}
+		return holder, true
+	}
+	return "", false
+}
+
+// the name of a running process where /proc has it
+func processName(pid string) string {
+	b, err := ioutil.ReadFile(filepath.Join("/proc", pid, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// the tool's lock was still held when reqs gave up waiting
+type LockError struct {
+	Tool, Holder string
+	Waited       time.Duration
+}
+
+func (e *LockError) Error() string {
+	return e.Tool + " is still locked by " + e.Holder + " after waiting " + e.Waited.String()
+}
+
+// sleep before the attempt'th retry, an error when ctx is done first
+func backoff(ctx context.Context, attempt int) error {
+	delay := lockDelay << uint(attempt)
+	if delay > maxLockDelay || delay <= 0 {
+		delay = maxLockDelay
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// run c, waiting up to pc.LockTimeout for the tool's lock while another
+// process holds it
+func (pc PackageConfig) runLocked(ctx context.Context, c Command) error {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		_, err := streamCommand(ctx, pc.Tool, pc.Quiet, c)
+		exitErr, ok := err.(*ExitError)
+		if !ok {
+			return err
+		}
+		holder, locked := lockHolder(pc.Tool, exitErr.Stderr)
+		if !locked {
+			return err
+		}
+		waited := time.Since(start)
+		if waited >= pc.LockTimeout {
+			return &LockError{Tool: pc.Tool, Holder: holder, Waited: waited.Round(time.Second)}
+		}
+		log.Warn(pc.Tool + " is locked by " + holder + ", waiting for it to finish")
+		waitCtx, cancel := context.WithTimeout(ctx, pc.LockTimeout-waited)
+		err = backoff(waitCtx, attempt)
+		cancel()
+		if ctx.Err() != nil {
+			return interrupted(ctx, c)
+		}
+		if err != nil {
+			return &LockError{Tool: pc.Tool, Holder: holder, Waited: time.Since(start).Round(time.Second)}
+		}
+	}
+}
+
+// where reqs takes its own lock, one path for every user so runs by
+// different users on a host take turns too.  Anyone can create a file in
+// /var/lock or /tmp, so AcquireRunLock opens it without following symlinks
+// and refuses anything but a plain file with a single link
+var DefaultLockPath = defaultLockPath()
+
+func defaultLockPath() string {
+	for _, dir := range []string{"/var/lock", "/tmp"} {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return filepath.Join(dir, "reqs.lock")
+		}
+	}
+	return filepath.Join(os.TempDir(), "reqs.lock")
+}
+
+// an advisory lock held by one reqs run at a time
+type RunLock struct {
+	file *os.File
+}
+
+// take the lock at path, waiting up to timeout while another reqs run
+// holds it
+func AcquireRunLock(ctx context.Context, path string, timeout time.Duration) (*RunLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	// a symlink in its place is refused rather than followed, and a lock
+	// another user created without write access for others is still
+	// locked, only without recording the holder
+	writable := true
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|lockOpenFlags, 0666)
+	if os.IsPermission(err) {
+		writable = false
+		f, err = os.OpenFile(path, os.O_RDONLY|lockOpenFlags, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLockFile(f); err != nil {
+		f.Close()
+		return nil, errors.New("refusing to lock " + path + ": " + err.Error())
+	}
+	// the umask usually takes write access from other users, who need it
+	// to lock the same file
+	if writable {
+		f.Chmod(0666)
+	}
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			// record who holds it for the next run to report, only once
+			// it is held so a waiting run never truncates it
+			if writable && f.Truncate(0) == nil {
+				f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+			}
+			return &RunLock{file: f}, nil
+		}
+		holder := "another reqs run"
+		b := make([]byte, 32)
+		if n, _ := f.ReadAt(b, 0); len(strings.TrimSpace(string(b[:n]))) > 0 {
+			holder = "reqs process " + strings.TrimSpace(string(b[:n]))
+		}
+		waited := time.Since(start)
+		if waited >= timeout {
+			f.Close()
+			return nil, &LockError{Tool: "reqs", Holder: holder, Waited: waited.Round(time.Second)}
+		}
+		log.Warn("Waiting for " + holder + " to finish, it holds " + path)
+		waitCtx, cancel := context.WithTimeout(ctx, timeout-waited)
+		err = backoff(waitCtx, attempt)
+		cancel()
+		if ctx.Err() != nil {
+			f.Close()
+			return nil, &InterruptedError{Cause: context.Cause(ctx)}
+		}
+		if err != nil {
+			f.Close()
+			return nil, &LockError{Tool: "reqs", Holder: holder, Waited: time.Since(start).Round(time.Second)}
+		}
+	}
+}
+
+func (l *RunLock) Release() error {
+	return l.file.Close()
+}
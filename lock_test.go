@@ -0,0 +1,99 @@
+package reqs
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLockHolder(t *testing.T) {
+	holder, locked := lockHolder("apt", "E: Could not get lock /var/lib/dpkg/lock-frontend. It is held by process 2345 (unattended-upgr)\nN: Be aware that removing the lock file is not a solution and may break your system.")
+	assert.True(t, locked)
+	assert.Equal(t, "process 2345 (unattended-upgr)", holder)
+
+	holder, locked = lockHolder("apt", "E: Could not get lock /var/lib/dpkg/lock - open (11: Resource temporarily unavailable)\nE: Unable to lock the administration directory (/var/lib/dpkg/), is another process using it?")
+	assert.True(t, locked)
+	assert.Equal(t, "another process", holder)
+
+	holder, locked = lockHolder("yum", "Another app is currently holding the yum lock; waiting for it to exit...\n  The other application is: PackageKit\n    Memory : 151 M RSS (469 MB VSZ)\n    State  : Sleeping, pid: 1862")
+	assert.True(t, locked)
+	assert.Equal(t, "process 1862 (PackageKit)", holder)
+
+	_, locked = lockHolder("apt", "E: Unable to locate package nope")
+	assert.False(t, locked)
+}
+
+func TestRunLocked(t *testing.T) {
+	fake := useFakeRunner(t)
+	prev := lockDelay
+	lockDelay = time.Millisecond
+	t.Cleanup(func() { lockDelay = prev })
+	locked := "E: Could not get lock /var/lib/dpkg/lock-frontend. It is held by process 2345 (unattended-upgr)"
+	fake.Results["apt install"] = FakeResult{Stderr: locked, ExitCode: 100, Times: 2}
+
+	pc := PackageConfig{Tool: "apt", AutoYes: "-y", Reqs: "git", Quiet: true, LockTimeout: time.Minute}
+	assert.Empty(t, pc.Install(context.Background(), false))
+	assert.Equal(t, []string{"apt install -y git", "apt install -y git", "apt install -y git"}, fake.CommandLines())
+
+	fake.Results["apt install"] = FakeResult{Stderr: locked, ExitCode: 100}
+	pc.LockTimeout = 0
+	err := pc.runLocked(context.Background(), Command{Argv: []string{"apt", "install", "-y", "git"}})
+	assert.Equal(t, "apt is still locked by process 2345 (unattended-upgr) after waiting 0s", err.Error())
+}
+
+func TestRunLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs aren't serialized on windows")
+	}
+	dir, err := ioutil.TempDir("", "reqs-lock-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "reqs.lock")
+
+	lock, err := AcquireRunLock(context.Background(), path, 0)
+	assert.Nil(t, err)
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0666), info.Mode().Perm())
+	_, err = AcquireRunLock(context.Background(), path, 0)
+	assert.IsType(t, &LockError{}, err)
+	assert.Contains(t, err.Error(), "reqs process "+strconv.Itoa(os.Getpid()))
+	assert.Nil(t, lock.Release())
+	lock, err = AcquireRunLock(context.Background(), path, 0)
+	assert.Nil(t, err)
+	lock.Release()
+
+	// a planted symlink is neither followed nor truncated
+	target := filepath.Join(dir, "target")
+	assert.Nil(t, ioutil.WriteFile(target, []byte("keep"), 0644))
+	link := filepath.Join(dir, "link.lock")
+	assert.Nil(t, os.Symlink(target, link))
+	_, err = AcquireRunLock(context.Background(), link, 0)
+	assert.NotNil(t, err)
+	b, err := ioutil.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, "keep", string(b))
+
+	// and so is a hard link to another file
+	hardLink := filepath.Join(dir, "hard.lock")
+	assert.Nil(t, os.Link(target, hardLink))
+	_, err = AcquireRunLock(context.Background(), hardLink, 0)
+	assert.EqualError(t, err, "refusing to lock "+hardLink+": it has more than one link")
+	b, err = ioutil.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, "keep", string(b))
+}
+
+func TestDefaultLockPath(t *testing.T) {
+	// the same for every user
+	assert.Equal(t, "reqs.lock", filepath.Base(DefaultLockPath))
+	if runtime.GOOS != "windows" {
+		assert.Contains(t, []string{"/var/lock/reqs.lock", "/tmp/reqs.lock"}, DefaultLockPath)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package reqs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// AcquireRunLock refuses to follow a symlink at the lock's path
+const lockOpenFlags = syscall.O_NOFOLLOW
+
+// take an exclusive flock on f without blocking, false while another
+// process holds it
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// a lock anyone can create must be a plain file, a hard link to some other
+// file would have its contents replaced by the holder's pid
+func checkLockFile(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("it is not a regular file")
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Nlink != 1 {
+		return errors.New("it has more than one link")
+	}
+	return nil
+}
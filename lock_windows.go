@@ -0,0 +1,16 @@
+package reqs
+
+import (
+	"os"
+)
+
+const lockOpenFlags = 0
+
+// runs of reqs aren't serialized on windows
+func tryLock(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func checkLockFile(f *os.File) error {
+	return nil
+}
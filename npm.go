@@ -1,60 +1,118 @@
 package reqs
 
 import (
-	"bytes"
-	"fmt"
+	"context"
+	"encoding/json"
+	"errors"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 func FindNpmPackageDirs(dir string, recurse bool) (packageDirs []string) {
-	const packageJson = "package.json"
-	if recurse {
-		err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-			if strings.Contains(path, packageJson) && !strings.Contains(path, "node_modules") && !strings.Contains(path, "bower_components") {
-				d, _ := filepath.Split(path)
-				log.Info("Found npm package directory " + d)
-				packageDirs = append(packageDirs, d)
-			}
-			return nil
-		})
-		FatalCheck(err)
-	} else {
-		if _, err := os.Stat(dir + "/" + packageJson); !os.IsNotExist(err) {
-			log.Info("Found npm package directory " + dir)
-			packageDirs = append(packageDirs, dir)
+	paths, err := DefaultDiscovery.findPackageJSON(dir, recurse)
+	FatalCheck(err)
+	// npm reads package.json itself, so its signature is checked just
+	// before npm install runs in its directory
+	var files []RequirementsFile
+	for _, path := range paths {
+		files = append(files, RequirementsFile{Path: path})
+	}
+	FatalCheck(DefaultDiscovery.Verify(dir, files))
+	for _, path := range paths {
+		d := dir
+		if recurse {
+			d, _ = filepath.Split(path)
 		}
+		log.Info("Found npm package directory " + d)
+		packageDirs = append(packageDirs, d)
 	}
 	return packageDirs
 }
 
+// the package.json files in dir, or under it when recursing
+func (d *Discovery) findPackageJSON(dir string, recurse bool) (paths []string, err error) {
+	const packageJson = "package.json"
+	if !recurse {
+		if _, err := os.Stat(filepath.Join(dir, packageJson)); !os.IsNotExist(err) {
+			paths = append(paths, filepath.Join(dir, packageJson))
+		}
+		return paths, nil
+	}
+	// node_modules and bower_components are pruned by DefaultIgnoreDirs
+	err = d.Walk(dir, recurse, func(path string, f os.FileInfo) {
+		if filepath.Base(path) == packageJson {
+			paths = append(paths, path)
+		}
+	})
+	return paths, err
+}
+
 func GetNpmRequirements(dir string, recurse bool) (text string) {
-	const reqsYml = "reqs.yml"
-	const npmRequirements = "npm-requirements.txt"
-	fileNames := GetRequirementFilenames(dir, recurse)
-	for _, fname := range fileNames {
-		if strings.HasSuffix(fname, npmRequirements) {
-			log.Info("Found " + fname)
-			b, err := ioutil.ReadFile(fname)
-			FatalCheck(err)
-			text = AppendNewLinesOnly(text, string(b))
-		} else if strings.Contains(fname, reqsYml) {
-			log.Info("Found " + fname)
-			conf := ymlToMap(fname)
-			for tool, packages := range conf {
-				if tool == "npm" {
-					for _, p := range packages {
-						text = AppendNewLinesOnly(text, string(p))
-					}
+	return RequirementsList(findNpmRequirements(dir, recurse))
+}
+
+func findNpmRequirements(dir string, recurse bool) (found []Requirement) {
+	for _, rf := range findRequirementsFiles(dir, recurse) {
+		found = append(found, npmRequirementsIn(rf)...)
+	}
+	return found
+}
+
+// the npm requirements in one requirements file
+func npmRequirementsIn(rf RequirementsFile) (found []Requirement) {
+	if rf.Kind == KindToolRequirements && rf.Tool == "npm" {
+		log.Info("Found " + rf.Path)
+		found = parseRequirementsText(string(readRequirements(rf.Path)), "npm", rf.Path)
+	} else if rf.Kind == KindReqsYml {
+		log.Info("Found " + rf.Path)
+		found = ymlRequirements(rf.Path, "npm", "npm")
+	}
+	return found
+}
+
+// the dependencies npm install installs from the package.json in dir,
+// with the lines they are on, for checking them against policies
+func PackageJSONRequirements(dir string) (found []Requirement, err error) {
+	path := filepath.Join(dir, "package.json")
+	b, err := DefaultDiscovery.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := json.Unmarshal(b, &pkg); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	lines := strings.Split(string(b), "\n")
+	for _, deps := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.OptionalDependencies} {
+		for name, version := range deps {
+			// versions can be urls with an @ of their own
+			r := Requirement{Name: name, Version: version, Tool: "npm", spec: name + "@" + version}
+			r.Source = path
+			// best effort, the first line starting with the quoted name
+			quoted, _ := json.Marshal(name)
+			for i, line := range lines {
+				if strings.HasPrefix(strings.TrimSpace(line), string(quoted)) {
+					r.Line = i + 1
+					break
 				}
 			}
+			found = append(found, r)
 		}
 	}
-	return strings.TrimSpace(strings.Replace(text, "\n", " ", -1))
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Line != found[j].Line {
+			return found[i].Line < found[j].Line
+		}
+		return found[i].Name < found[j].Name
+	})
+	return found, nil
 }
 
 func GetNpmRequirementsMultipleDirs(dirPaths []string, recurse bool) (reqs string) {
@@ -64,7 +122,7 @@ func GetNpmRequirementsMultipleDirs(dirPaths []string, recurse bool) (reqs strin
 	return reqs
 }
 
-func NpmInstall(requirements, dir string, sudo, global, quiet bool) {
+func NpmInstall(ctx context.Context, requirements, dir string, sudo, global, quiet bool) {
 	if dir != "" {
 		dir, _ = filepath.Abs(dir)
 	}
@@ -77,33 +135,24 @@ func NpmInstall(requirements, dir string, sudo, global, quiet bool) {
 		}
 		log.Info("Running npm install" + logDir)
 	}
-	sudoArg := ""
+	FatalCheck(ValidatePackageList("npm", requirements))
+	var argv []string
 	if sudo {
-		sudoArg = "sudo "
+		argv = append(argv, "sudo")
 	}
-	globalArg := ""
+	argv = append(argv, "npm")
 	if global {
-		globalArg = "-g "
-	}
-	cmdStr := sudoArg + "npm " + globalArg + "install " + requirements
-	log.Info(cmdStr)
-	cmd := exec.Command("/bin/sh", "-c", cmdStr)
-	if dir != "" {
-		cmd.Dir = dir
-	}
-	cmd.Env = []string{
-		"PATH=" + os.ExpandEnv("$PATH"),
-	}
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if !quiet {
-		fmt.Print(string(out.String()))
-	}
-	if err != nil {
-		log.Fatal(err)
-		log.Fatal(stderr.String())
+		argv = append(argv, "-g")
 	}
+	argv = append(argv, "install")
+	argv = append(argv, strings.Fields(requirements)...)
+	log.Info(strings.Join(argv, " "))
+	_, err := streamCommand(ctx, "npm", quiet, Command{
+		Argv: argv,
+		Env: []string{
+			"PATH=" + os.ExpandEnv("$PATH"),
+		},
+		Dir: dir,
+	})
+	FatalCheck(err)
 }
@@ -0,0 +1,68 @@
+package reqs
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// optional and any-of requirements from reqs.yml are settled against what
+// the package tool can install before anything is installed
+
+// commands that exit 0 when the tool has the package appended to them
+var availabilityQueries = map[string][]string{
+	"apt":    {"apt-cache", "show", "-q"},
+	"dnf":    {"dnf", "list", "-q"},
+	"yum":    {"yum", "list", "-q"},
+	"brew":   {"brew", "info"},
+	FakeTool: {FakeTool, "show"},
+}
+
+// whether pc.Tool can install pkg, installed or not
+func (pc PackageConfig) Available(ctx context.Context, pkg string) bool {
+	query, ok := availabilityQueries[pc.Tool]
+	if !ok || ValidatePackageName(pc.Tool, pkg) != nil {
+		return false
+	}
+	_, err := DefaultRunner.Run(ctx, Command{Argv: append(append([]string{}, query...), pkg)})
+	if err != nil {
+		if _, ok := err.(*ExitError); !ok {
+			FatalCheck(err)
+		}
+		return false
+	}
+	return true
+}
+
+// choose the first alternative pc.Tool has for each any-of requirement
+// and set aside the optional requirements it doesn't have, those are
+// returned skipped and any-of requirements without an alternative failed
+func (pc PackageConfig) Resolve(ctx context.Context, found []Requirement) (resolved, unresolved []Requirement) {
+	for _, r := range found {
+		switch {
+		case len(r.Alternatives) > 0:
+			chosen := ""
+			for _, alt := range r.Alternatives {
+				if pc.Available(ctx, alt) {
+					chosen = alt
+					break
+				}
+			}
+			if chosen == "" {
+				r.Status = StatusFailed
+				r.Error = pc.Tool + " has none of " + strings.Join(r.Alternatives, ", ")
+				unresolved = append(unresolved, r)
+				continue
+			}
+			log.Info("Using " + chosen + " of " + strings.Join(r.Alternatives, ", "))
+			resolved = append(resolved, r.choose(chosen))
+		case r.Optional && !pc.Available(ctx, r.Name):
+			log.Warn("Skipping optional package " + r.Name + ", " + pc.Tool + " doesn't have it")
+			r.Status = StatusSkipped
+			unresolved = append(unresolved, r)
+		default:
+			resolved = append(resolved, r)
+		}
+	}
+	return resolved, unresolved
+}
@@ -0,0 +1,123 @@
+package reqs
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strings"
+)
+
+// structured output of listings and install results for other tooling
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// statuses reported for requirements
+const (
+	StatusInstalled = "installed"
+	StatusMissing   = "missing"
+	StatusPlanned   = "planned"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+type sourceEntry struct {
+	Tool   string `json:"tool" yaml:"tool"`
+	Source string `json:"source" yaml:"source"`
+}
+
+func ValidFormat(format string) bool {
+	return StringInSlice(format, []string{FormatText, FormatJSON, FormatYAML})
+}
+
+func encode(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case FormatYAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	return fmt.Errorf("unsupported format %s", format)
+}
+
+// write requirements one entry per line as text, or as a json or yaml list
+func PrintRequirements(w io.Writer, format string, found []Requirement) error {
+	if format == FormatText || format == "" {
+		if len(found) == 0 {
+			return nil
+		}
+		_, err := fmt.Fprintln(w, joinRequirements(found))
+		return err
+	}
+	if found == nil {
+		found = []Requirement{}
+	}
+	return encode(w, format, found)
+}
+
+// write the newline separated package tool sources in the given format
+func PrintSources(w io.Writer, format, tool, sources string) error {
+	if format == FormatText || format == "" {
+		_, err := fmt.Fprint(w, sources)
+		return err
+	}
+	entries := []sourceEntry{}
+	for _, line := range strings.Split(sources, "\n") {
+		if strings.TrimSpace(line) != "" {
+			entries = append(entries, sourceEntry{Tool: tool, Source: strings.TrimSpace(line)})
+		}
+	}
+	return encode(w, format, entries)
+}
+
+// mark every requirement with status
+func WithStatus(found []Requirement, status string) []Requirement {
+	marked := make([]Requirement, len(found))
+	for i, r := range found {
+		r.Status = status
+		marked[i] = r
+	}
+	return marked
+}
+
+// mark the requirements installed, or failed with the reason for those
+// in failures
+func WithFailures(found []Requirement, failures []InstallFailure) []Requirement {
+	reasons := make(map[string]string)
+	for _, f := range failures {
+		reasons[f.Package] = f.Reason
+	}
+	marked := WithStatus(found, StatusInstalled)
+	for i, r := range marked {
+		if reason, ok := reasons[r.Spec()]; ok {
+			marked[i].Status = StatusFailed
+			marked[i].Error = reason
+		}
+	}
+	return marked
+}
+
+// requirements for a space separated list of packages handed to a tool,
+// or for pip and pip3 a list of requirement lines
+func RequirementsFromList(list, tool string) (found []Requirement) {
+	if tool != "pip" && tool != "pip3" {
+		list = strings.Replace(list, " ", "\n", -1)
+	}
+	for _, r := range parseRequirementsText(list, tool, "") {
+		// lines of the joined list say nothing about the source files
+		r.Line = 0
+		found = append(found, r)
+	}
+	return found
+}
@@ -1,27 +1,27 @@
 package reqs
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	log "github.com/sirupsen/logrus"
-	"os/exec"
+	"os"
+	"strings"
+	"time"
 )
 
 // responsible for interfacing with package tools
 // deals with apt, brew, and dnf, pip
 
-func runShell(code string) {
-	log.Info(code)
-	cmd := exec.Command("/bin/sh", "-c", code)
-	err := cmd.Run()
-	FatalCheck(err)
-}
+// the system package tools reqs can install with
+var PackageTools = []string{"apt", "dnf", "yum", "brew", FakeTool}
 
 type PackageConfig struct {
 	Tool          string
 	Sudo, AutoYes string
 	Reqs          string
 	Quiet, Force  bool
+	// how long to wait for the tool's lock while another process holds
+	// it, zero fails straight away
+	LockTimeout time.Duration
 }
 
 func (pc PackageConfig) getForceArg() (forceArg string) {
@@ -35,49 +35,100 @@ func (pc PackageConfig) getForceArg() (forceArg string) {
 	return forceArg
 }
 
-func (pc PackageConfig) Install(upgrade bool) {
+// sudo, if needed, followed by the tool
+func (pc PackageConfig) toolArgv() []string {
+	return append(strings.Fields(pc.Sudo), pc.Tool)
+}
+
+// a package the tool failed to install and the reason it gave
+type InstallFailure struct {
+	Package, Reason string
+}
+
+// install pc.Reqs in one run of the tool, when that run fails the
+// packages are bisected so everything installable still gets installed
+// and each failure comes down to a single package
+func (pc PackageConfig) Install(ctx context.Context, upgrade bool) []InstallFailure {
 	log.Info("Installing system requirements with " + pc.Tool)
-	forceArg := pc.getForceArg()
-	envArg := ""
+	FatalCheck(ValidatePackageList(pc.Tool, pc.Reqs))
+	return pc.installBatch(ctx, strings.Fields(pc.Reqs), upgrade)
+}
+
+func (pc PackageConfig) installBatch(ctx context.Context, pkgs []string, upgrade bool) []InstallFailure {
+	err := pc.runInstall(ctx, pkgs, upgrade)
+	if err == nil {
+		return nil
+	}
+	exitErr, ok := err.(*ExitError)
+	if !ok {
+		// the tool didn't run at all or was interrupted, retrying won't help
+		FatalCheck(err)
+	}
+	if len(pkgs) == 1 {
+		return []InstallFailure{{Package: pkgs[0], Reason: failureReason(exitErr.Stderr)}}
+	}
+	log.Warn(pc.Tool + " failed to install " + strings.Join(pkgs, " ") + ", retrying them in halves")
+	half := len(pkgs) / 2
+	return append(pc.installBatch(ctx, pkgs[:half], upgrade), pc.installBatch(ctx, pkgs[half:], upgrade)...)
+}
+
+func (pc PackageConfig) runInstall(ctx context.Context, pkgs []string, upgrade bool) error {
+	var env []string
 	if pc.Tool == "brew" {
-		envArg += "HOMEBREW_NO_AUTO_UPDATE=1 "
+		env = append(os.Environ(), "HOMEBREW_NO_AUTO_UPDATE=1")
 	}
-	upgradeArg := ""
+	argv := append(pc.toolArgv(), "install")
+	argv = append(argv, strings.Fields(pc.AutoYes)...)
+	argv = append(argv, strings.Fields(pc.getForceArg())...)
 	if upgrade {
 		if pc.Tool == "apt" {
-			upgradeArg = "--upgrade "
+			argv = append(argv, "--upgrade")
 		}
 	}
-	cmdStr := envArg + pc.Sudo + pc.Tool + " install " + pc.AutoYes + forceArg + upgradeArg + pc.Reqs
-	log.Info(cmdStr)
-	cmd := exec.Command("/bin/sh", "-c", cmdStr)
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if !pc.Quiet {
-		fmt.Print(string(out.String()))
+	argv = append(argv, pkgs...)
+	log.Info(strings.Join(argv, " "))
+	return pc.runLocked(ctx, Command{Argv: argv, Env: env})
+}
+
+// the error lines of a failed install, apt starts them with E: and dnf
+// and brew with Error:, otherwise the last line the tool wrote
+func failureReason(stderr string) string {
+	var reasons []string
+	last := ""
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		last = line
+		if strings.HasPrefix(line, "E:") || strings.HasPrefix(line, "Error:") || strings.HasPrefix(line, "No match for argument") {
+			reasons = append(reasons, line)
+		}
 	}
-	if err != nil {
-		log.Fatal(stderr.String())
+	if len(reasons) == 0 {
+		if last == "" {
+			return "install failed without a reason"
+		}
+		return last
 	}
+	return strings.Join(reasons, "; ")
 }
 
-func (pc PackageConfig) abstractUp(upArg string) {
+func (pc PackageConfig) abstractUp(ctx context.Context, upArg string) {
 	log.Info("Running " + pc.Tool + " packages " + upArg)
-	forceArg := pc.getForceArg()
-	if pc.Tool == "brew" {
-		runShell(pc.Tool + " " + upArg + " " + forceArg)
-	} else {
-		runShell("sudo " + pc.Tool + " " + upArg + " " + forceArg + pc.AutoYes)
+	argv := append(pc.toolArgv(), upArg)
+	argv = append(argv, strings.Fields(pc.getForceArg())...)
+	if pc.Tool != "brew" {
+		argv = append(argv, strings.Fields(pc.AutoYes)...)
 	}
+	log.Info(strings.Join(argv, " "))
+	FatalCheck(pc.runLocked(ctx, Command{Argv: argv}))
 }
 
-func (pc PackageConfig) Update() {
-	pc.abstractUp("update")
+func (pc PackageConfig) Update(ctx context.Context) {
+	pc.abstractUp(ctx, "update")
 }
 
-func (pc PackageConfig) Upgrade() {
-	pc.abstractUp("upgrade")
+func (pc PackageConfig) Upgrade(ctx context.Context) {
+	pc.abstractUp(ctx, "upgrade")
 }
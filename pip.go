@@ -2,86 +2,44 @@ package reqs
 
 import (
 	"bufio"
-	"bytes"
-	"fmt"
+	"context"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 )
 
 func GetPipRequirements(dirPath string, recurse bool) (text string) {
-	const reqsYml = "reqs.yml"
-	const pipRequirements = "requirements.txt"
-	// possible variation
-	const pipRequirementsDarwin = "requirements-osx.txt"
-	fileNames := GetRequirementFilenames(dirPath, recurse)
-
-	for _, fname := range fileNames {
-		if runtime.GOOS == "darwin" {
-			if strings.HasSuffix(fname, pipRequirementsDarwin) {
-				log.Info("Found " + fname)
-				b, err := ioutil.ReadFile(fname)
-				FatalCheck(err)
-				text = AppendNewLinesOnly(text, string(b))
-			}
-		}
-		if strings.HasSuffix(fname, pipRequirements) && !strings.HasSuffix(fname, "-"+pipRequirements) {
-			log.Info("Found " + fname)
-			b, err := ioutil.ReadFile(fname)
-			FatalCheck(err)
-			text = AppendNewLinesOnly(text, string(b))
-		} else if strings.Contains(fname, reqsYml) {
-			log.Info("Found " + fname)
-			conf := ymlToMap(fname)
-			for tool, packages := range conf {
-				if tool == "pip" {
-					for _, p := range packages {
-						text = AppendNewLinesOnly(text, string(p))
-					}
-				}
-			}
-		}
-	}
-	return strings.TrimSpace(strings.Replace(text, "\n", " ", -1))
+	return RequirementLines(findPipRequirements(dirPath, "pip", recurse))
 }
 
 func GetPip3Requirements(dirPath string, recurse bool) (text string) {
-	const reqsYml = "reqs.yml"
-	const pipRequirements = "requirements.txt"
-	// possible variation
-	const pipRequirementsDarwin = "requirements-osx.txt"
-	fileNames := GetRequirementFilenames(dirPath, recurse)
-
-	for _, fname := range fileNames {
-		if runtime.GOOS == "darwin" {
-			if strings.HasSuffix(fname, pipRequirementsDarwin) {
-				log.Info("Found " + fname)
-				b, err := ioutil.ReadFile(fname)
-				FatalCheck(err)
-				text = AppendNewLinesOnly(text, string(b))
-			}
-		}
-		if strings.HasSuffix(fname, pipRequirements) && !strings.HasSuffix(fname, "-"+pipRequirements) {
-			log.Info("Found " + fname)
-			b, err := ioutil.ReadFile(fname)
-			FatalCheck(err)
-			text = AppendNewLinesOnly(text, string(b))
-		} else if strings.Contains(fname, reqsYml) {
-			log.Info("Found " + fname)
-			conf := ymlToMap(fname)
-			for tool, packages := range conf {
-				if tool == "pip3" {
-					for _, p := range packages {
-						text = AppendNewLinesOnly(text, string(p))
-					}
-				}
-			}
-		}
+	return RequirementLines(findPipRequirements(dirPath, "pip3", recurse))
+}
+
+// read requirements.txt files, requirements-osx.txt on darwin, and the
+// pip or pip3 section of reqs.yml files, each line a requirement since pip
+// lines can hold options, urls and environment markers
+func findPipRequirements(dirPath, section string, recurse bool) (found []Requirement) {
+	for _, rf := range findRequirementsFiles(dirPath, recurse) {
+		found = append(found, pipRequirementsIn(rf, section)...)
+	}
+	return found
+}
+
+// the pip or pip3 requirements in one requirements file
+func pipRequirementsIn(rf RequirementsFile, section string) (found []Requirement) {
+	if rf.Kind == KindPipRequirements || (rf.Kind == KindPipDarwinRequirements && runtime.GOOS == "darwin") {
+		log.Info("Found " + rf.Path)
+		found = parseRequirementsText(string(readRequirements(rf.Path)), section, rf.Path)
+	} else if rf.Kind == KindReqsYml {
+		log.Info("Found " + rf.Path)
+		found = ymlRequirements(rf.Path, section, section)
 	}
-	return strings.TrimSpace(strings.Replace(text, "\n", " ", -1))
+	return found
 }
 
 func GetPipRequirementsMultipleDirs(dirPaths []string, recurse bool) (reqs string) {
@@ -98,30 +56,32 @@ func GetPip3RequirementsMultipleDirs(dirPaths []string, recurse bool) (reqs stri
 	return reqs
 }
 
-// pip install given requirements, optionally --upgrade as well
-func PipInstall(requirements, pipPath string, sudo, upgrade, quiet bool) {
+// pip install given requirements, one a line, optionally --upgrade as well
+func PipInstall(ctx context.Context, requirements, pipPath string, sudo, upgrade, quiet bool) {
 	// because pip requirements.txt files can be more complicated than the
 	// cli accepts with args, we write out the requirements to a temporary
-	// file and then pass the file with -r to pip to read
+	// file and then pass the file with -r to pip to read.  The lines never
+	// reach a command line, but pip runs whatever options they hold, so
+	// only the options pip documents for requirements files get through
+	FatalCheck(ValidatePipRequirements("pip", requirements))
 	log.Info("Installing " + pipPath + " requirements to currently active environment")
-	sudoArg := ""
+	var argv []string
 	if sudo {
-		sudoArg = "sudo "
+		argv = append(argv, "sudo")
 	}
-	upgradeArg := ""
+	argv = append(argv, pipPath, "install")
 	if upgrade {
-		upgradeArg = "--upgrade "
+		argv = append(argv, "--upgrade")
 	}
-	quietArg := ""
 	if quiet {
-		quietArg = "-q "
+		argv = append(argv, "-q")
 	}
 
-	tmpReqsFile, err := ioutil.TempFile("/tmp", "reqs-")
+	tmpReqsFile, err := ioutil.TempFile("", "reqs-")
 	FatalCheck(err)
 	defer os.Remove(tmpReqsFile.Name())
 
-	reqLines := strings.Split(requirements, " ")
+	reqLines := strings.Split(requirements, "\n")
 	w := bufio.NewWriter(tmpReqsFile)
 
 	for _, line := range reqLines {
@@ -130,27 +90,148 @@ func PipInstall(requirements, pipPath string, sudo, upgrade, quiet bool) {
 	}
 	w.Flush()
 
-	cmdStr := sudoArg + pipPath + " install " + upgradeArg + quietArg + "-r " + tmpReqsFile.Name()
+	argv = append(argv, "-r", tmpReqsFile.Name())
 	if !quiet {
-		log.Info(cmdStr)
+		log.Info(strings.Join(argv, " "))
 	}
 
-	cmd := exec.Command("/bin/sh", "-c", cmdStr)
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	cmd.Env = []string{
-		"PATH=" + os.ExpandEnv("$PATH"),
-		"PYTHONPATH=" + os.ExpandEnv("$PYTHONPATH"),
-		"PYENV_VIRTUAL_ENV=" + os.ExpandEnv("$PYENV_VIRTUAL_ENV"),
-		"PYENV_VERSION=" + os.ExpandEnv("$PYENV_VERSION"),
+	_, err = streamCommand(ctx, pipPath, quiet, Command{
+		Argv: argv,
+		Env: []string{
+			"PATH=" + os.ExpandEnv("$PATH"),
+			"PYTHONPATH=" + os.ExpandEnv("$PYTHONPATH"),
+			"PYENV_VIRTUAL_ENV=" + os.ExpandEnv("$PYENV_VIRTUAL_ENV"),
+			"PYENV_VERSION=" + os.ExpandEnv("$PYENV_VERSION"),
+		},
+	})
+	FatalCheck(err)
+}
+
+// options whose value is a path, pip resolves them against its working
+// directory or the file it reads them from, neither of which is the
+// directory of the requirements file they were written in
+var pipPathOptions = []string{"-r", "--requirement", "-c", "--constraint", "-e", "--editable", "-f", "--find-links"}
+
+// the requirement as a line of the file PipInstall writes, relative paths
+// made absolute against the directory of the file it came from
+func pipLine(r Requirement) string {
+	line := r.Spec()
+	if r.Source == "" {
+		return line
 	}
-	err = cmd.Run()
-	if !quiet {
-		fmt.Print(string(out.String()))
+	dir := filepath.Dir(r.Source)
+	if strings.HasPrefix(line, "-") {
+		opt, value := splitPipOption(line)
+		for _, pathOpt := range pipPathOptions {
+			if opt == pathOpt && value != "" && !strings.Contains(value, "://") {
+				return opt + " " + pipPath(dir, value)
+			}
+		}
+		return line
+	}
+	if strings.HasPrefix(line, ".") {
+		path, rest := line, ""
+		if i := strings.IndexAny(line, " ;"); i != -1 {
+			path, rest = line[:i], line[i:]
+		}
+		return pipPath(dir, path) + rest
+	}
+	return line
+}
+
+// path joined to dir unless it is absolute, keeping any [extras] after it
+func pipPath(dir, path string) string {
+	extras := ""
+	if i := strings.Index(path, "["); i != -1 {
+		path, extras = path[:i], path[i:]
+	}
+	if !filepath.IsAbs(path) {
+		path = absPath(filepath.Join(dir, path))
+	}
+	return path + extras
+}
+
+// split an option line into the option and its value, given after a space
+// or an =
+func splitPipOption(line string) (opt, value string) {
+	if i := strings.IndexAny(line, " \t="); i != -1 {
+		return line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return line, ""
+}
+
+// the package named by the #egg= fragment of a url
+var eggFragment = regexp.MustCompile(`[#&]egg=([A-Za-z0-9][A-Za-z0-9._\-]*)`)
+
+// the package a pip url line installs, given as name @ url or with #egg=
+// on the url, optionally after -e
+func pipURLName(spec string) (string, bool) {
+	if opt, value := splitPipOption(spec); opt == "-e" || opt == "--editable" {
+		spec = value
+	}
+	at := strings.Index(spec, "://")
+	if at == -1 {
+		return "", false
+	}
+	if i := strings.Index(spec, "@"); i != -1 && i < at {
+		name := strings.TrimSpace(spec[:i])
+		if j := strings.Index(name, "["); j != -1 {
+			name = name[:j]
+		}
+		return strings.TrimSpace(name), true
+	}
+	if match := eggFragment.FindStringSubmatch(spec); match != nil {
+		return match[1], true
+	}
+	return "", false
+}
+
+// the urls and paths a pip line installs from or reads, paths absolute
+// against the directory of its file
+func pipSources(r Requirement) []string {
+	line := pipLine(r)
+	if strings.HasPrefix(line, "-") {
+		switch opt, value := splitPipOption(line); opt {
+		case "--only-binary", "--no-binary":
+			// package names, not sources
+			return nil
+		default:
+			if value != "" {
+				return []string{value}
+			}
+		}
+		return nil
+	}
+	if i := strings.Index(line, " --"); i != -1 {
+		line = line[:i]
+	}
+	if i := strings.Index(line, "; "); i != -1 {
+		line = line[:i]
+	}
+	if at := strings.Index(line, "://"); at != -1 {
+		if i := strings.Index(line, "@"); i != -1 && i < at {
+			line = line[i+1:]
+		}
+		return []string{strings.TrimSpace(line)}
+	}
+	if filepath.IsAbs(line) {
+		if i := strings.IndexAny(line, ";["); i != -1 {
+			line = line[:i]
+		}
+		return []string{strings.TrimSpace(line)}
+	}
+	return nil
+}
+
+// the file a pip -r line reads, pip reads it relative to the file the line
+// is in
+func pipRequirementFile(r Requirement) (string, bool) {
+	if r.Tool != "pip" && r.Tool != "pip3" {
+		return "", false
 	}
-	if err != nil {
-		log.Fatal(stderr.String())
+	opt, value := splitPipOption(pipLine(r))
+	if (opt == "-r" || opt == "--requirement") && value != "" {
+		return value, true
 	}
+	return "", false
 }
@@ -0,0 +1,258 @@
+package reqs
+
+import (
+	"errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// managed machines can be given a policy restricting what reqs installs.
+// Requirements are checked against every policy after discovery and an
+// install with violations stops before anything runs
+//
+//  deny:
+//    all: [telnetd, rsh-*]
+//    pip: [pycrypto]
+//  allow:
+//    npm: ["@example/*", left-pad]
+//  pin: [pip, pip3, npm]
+//  deny_sources:
+//    - http://**
+//    - /tmp/**
+
+// the system-wide policy, used when it exists
+var DefaultPolicyPath = "/etc/reqs/policy.yml"
+
+// policy rules keyed by this apply to every tool
+const policyAllTools = "all"
+
+type Policy struct {
+	// where the policy was read from
+	Path string `yaml:"-"`
+	// package name globs by tool, a tool with an allow list installs
+	// only the packages matching it
+	Allow map[string][]string `yaml:"allow"`
+	Deny  map[string][]string `yaml:"deny"`
+	// tools whose requirements must pin an exact version
+	Pin []string `yaml:"pin"`
+	// globs of requirements files and remote include urls, ** crossing
+	// directories
+	DenySources []string `yaml:"deny_sources"`
+}
+
+// the tools policy rules can name
+var policyTools = []string{policyAllTools, "apt", "brew", "dnf", "yum", "pip", "pip3", "npm"}
+
+func ParsePolicy(b []byte, source string) (p Policy, err error) {
+	if err := yaml.UnmarshalStrict(b, &p); err != nil {
+		return p, errors.New(source + ": " + err.Error())
+	}
+	p.Path = source
+	var tools []string
+	for tool := range p.Allow {
+		tools = append(tools, tool)
+	}
+	for tool := range p.Deny {
+		tools = append(tools, tool)
+	}
+	for _, tool := range append(tools, p.Pin...) {
+		if !StringInSlice(tool, policyTools) {
+			return p, errors.New(source + ": unknown tool " + tool + ", expected one of " + strings.Join(policyTools, ", "))
+		}
+	}
+	for _, patterns := range append(mapValues(p.Allow), mapValues(p.Deny)...) {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return p, errors.New(source + ": bad package pattern " + pattern)
+			}
+		}
+	}
+	for _, pattern := range p.DenySources {
+		if _, err := regexp.Compile(globToRegexp(pattern)); err != nil {
+			return p, errors.New(source + ": bad source pattern " + pattern)
+		}
+	}
+	return p, nil
+}
+
+func mapValues(m map[string][]string) (values [][]string) {
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+// the policy at systemPath when there is one and the policy at path
+// when it is given
+func LoadPolicies(systemPath, path string) (policies []Policy, err error) {
+	for _, p := range []string{systemPath, path} {
+		if p == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) && p == systemPath {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		policy, err := ParsePolicy(b, p)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// a requirement a policy forbids
+type PolicyViolation struct {
+	Requirement Requirement
+	Policy      string
+	Reason      string
+}
+
+func (v PolicyViolation) String() string {
+	r := v.Requirement
+	where := r.Tool + " requirements"
+	if r.Source != "" {
+		where = DefaultDiscovery.Origin(r.Source)
+		if r.Line > 0 {
+			where += ":" + strconv.Itoa(r.Line)
+		}
+	}
+	return where + ": " + r.Spec() + " " + v.Reason + ", policy " + v.Policy
+}
+
+func matchAny(patterns []string, name string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// whether r names an exact version in the syntax of its tool
+func pinned(r Requirement, tool string) bool {
+	switch {
+	case r.Version == "":
+		return false
+	case tool == "pip" || tool == "pip3":
+		return !strings.ContainsAny(r.Version, "<>!~=,*")
+	case tool == "npm":
+		return r.Version[0] >= '0' && r.Version[0] <= '9' && !strings.ContainsAny(r.Version, " |*x")
+	}
+	return true
+}
+
+// the violations of p by found, the requirements of files pip -r lines
+// read are checked as if they were in the files reading them
+func (p Policy) Check(found []Requirement) (violations []PolicyViolation) {
+	var sources []*regexp.Regexp
+	for _, pattern := range p.DenySources {
+		sources = append(sources, regexp.MustCompile("^"+globToRegexp(pattern)+"$"))
+	}
+	deniedSource := func(source string) (string, bool) {
+		for i, re := range sources {
+			if re.MatchString(source) {
+				return p.DenySources[i], true
+			}
+		}
+		return "", false
+	}
+	found = append([]Requirement{}, found...)
+	// files already checked aren't read again by a -r line
+	read := make(map[string]bool)
+	for _, r := range found {
+		if r.Source != "" {
+			read[absPath(r.Source)] = true
+		}
+	}
+	for i := 0; i < len(found); i++ {
+		r := found[i]
+		violate := func(reason string) {
+			violations = append(violations, PolicyViolation{Requirement: r, Policy: p.Path, Reason: reason})
+		}
+		tool := emulatedTool(r.Tool)
+		if path, ok := pipRequirementFile(r); ok && !read[path] {
+			read[path] = true
+			// urls included with -r aren't fetched to be checked
+			if b, err := ioutil.ReadFile(path); err != nil {
+				violate("reads " + path + ", which can't be checked")
+			} else {
+				found = append(found, parseRequirementsText(string(b), r.Tool, path)...)
+			}
+		}
+		if r.installs() {
+			deny := append(append([]string{}, p.Deny[policyAllTools]...), p.Deny[tool]...)
+			allow := append(append([]string{}, p.Allow[policyAllTools]...), p.Allow[tool]...)
+			names := r.Alternatives
+			if len(names) == 0 {
+				names = []string{r.Name}
+			}
+			for _, name := range names {
+				// alternatives are full specs
+				name, _ = splitVersion(name, r.Tool)
+				if pattern, ok := matchAny(deny, name); ok {
+					violate("is denied as " + pattern)
+				} else if _, ok := matchAny(allow, name); len(allow) > 0 && !ok {
+					violate("is not allowed, " + tool + " packages must match " + strings.Join(allow, ", "))
+				}
+			}
+			if (StringInSlice(tool, p.Pin) || StringInSlice(policyAllTools, p.Pin)) && !pinned(r, tool) {
+				violate("must pin an exact version")
+			}
+		}
+		if r.Source != "" {
+			if pattern, ok := deniedSource(DefaultDiscovery.Origin(r.Source)); ok {
+				violate("comes from a denied source " + pattern)
+			} else if pattern, ok := deniedSource(absPath(r.Source)); ok {
+				violate("comes from a denied source " + pattern)
+			}
+		}
+		for _, source := range installSources(r) {
+			if pattern, ok := deniedSource(source); ok {
+				violate("uses a denied source " + pattern)
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// whether r installs a package rather than being a pip option, editable
+// installs are packages too
+func (r Requirement) installs() bool {
+	if r.Tool != "pip" && r.Tool != "pip3" || !strings.HasPrefix(r.Name, "-") {
+		return true
+	}
+	opt, _ := splitPipOption(r.Name)
+	return opt == "-e" || opt == "--editable"
+}
+
+// the urls and paths r installs from besides its tool's package index
+func installSources(r Requirement) []string {
+	switch r.Tool {
+	case "pip", "pip3":
+		return pipSources(r)
+	case "npm":
+		if strings.Contains(r.Version, "://") {
+			return []string{r.Version}
+		}
+	}
+	return nil
+}
+
+// the violations of every policy by found
+func CheckPolicies(policies []Policy, found []Requirement) (violations []PolicyViolation) {
+	for _, p := range policies {
+		violations = append(violations, p.Check(found)...)
+	}
+	return violations
+}
@@ -0,0 +1,122 @@
+package reqs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`deny:
+  all: [telnetd, rsh-*]
+allow:
+  npm: ["@example/*", left-pad]
+pin: [pip]
+deny_sources:
+  - /tmp/untrusted/**
+`), "policy.yml")
+	assert.Nil(t, err)
+
+	found := []Requirement{
+		{Name: "git", Tool: "apt", Source: "reqs.yml", Line: 2},
+		{Name: "rsh-client", Tool: "apt", Source: "reqs.yml", Line: 3},
+		{Name: "telnet", Tool: "apt", Source: "reqs.yml", Line: 4, Alternatives: []string{"telnet", "telnetd"}},
+		NewRequirement("flask==1.0", "pip"),
+		NewRequirement("requests>=2.0", "pip"),
+		NewRequirement("@example/ui@1.0.0", "npm"),
+		NewRequirement("lodash", "npm"),
+		{Name: "curl", Tool: "apt", Source: "/tmp/untrusted/apt-requirements.txt", Line: 1},
+	}
+	var got []string
+	for _, v := range policy.Check(found) {
+		got = append(got, v.String())
+	}
+	assert.Equal(t, []string{
+		"reqs.yml:3: rsh-client is denied as rsh-*, policy policy.yml",
+		"reqs.yml:4: telnet is denied as telnetd, policy policy.yml",
+		"pip requirements: requests>=2.0 must pin an exact version, policy policy.yml",
+		"npm requirements: lodash is not allowed, npm packages must match @example/*, left-pad, policy policy.yml",
+		"/tmp/untrusted/apt-requirements.txt:1: curl comes from a denied source /tmp/untrusted/**, policy policy.yml",
+	}, got)
+
+	_, err = ParsePolicy([]byte("deny:\n  gem: [rails]\n"), "policy.yml")
+	assert.EqualError(t, err, "policy.yml: unknown tool gem, expected one of all, apt, brew, dnf, yum, pip, pip3, npm")
+	_, err = ParsePolicy([]byte("denied:\n  apt: [telnetd]\n"), "policy.yml")
+	assert.NotNil(t, err)
+}
+
+func TestLoadPolicies(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"policy.yml": "pin: [npm]\n",
+	})
+	defer os.RemoveAll(dir)
+
+	policies, err := LoadPolicies(filepath.Join(dir, "missing.yml"), "")
+	assert.Nil(t, err)
+	assert.Empty(t, policies)
+	policies, err = LoadPolicies(filepath.Join(dir, "missing.yml"), filepath.Join(dir, "policy.yml"))
+	assert.Nil(t, err)
+	assert.Equal(t, []Policy{{Path: filepath.Join(dir, "policy.yml"), Pin: []string{"npm"}}}, policies)
+	_, err = LoadPolicies(filepath.Join(dir, "policy.yml"), filepath.Join(dir, "missing.yml"))
+	assert.NotNil(t, err)
+}
+
+func TestPolicyCheckSources(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"vendored/requirements.txt": "# pinned upstream\nflask==1.0\n",
+		"web/package.json":          "{\n  \"name\": \"web\",\n  \"dependencies\": {\n    \"left-pad\": \"1.3.0\",\n    \"lodash\": \"^4.17.0\",\n    \"crypto-lib\": \"git+ssh://git@github.com/org/crypto-lib.git\"\n  }\n}\n",
+	})
+	defer os.RemoveAll(dir)
+	policy, err := ParsePolicy([]byte("deny_sources:\n  - \"**/vendored/requirements.txt\"\n  - \"git+ssh://**\"\npin: [npm]\n"), "policy.yml")
+	assert.Nil(t, err)
+
+	found := RequirementsParser{Dir: dir, Recurse: true}.ToolRequirements("pip")
+	packageFound, err := PackageJSONRequirements(filepath.Join(dir, "web"))
+	assert.Nil(t, err)
+	assert.Equal(t, "crypto-lib", packageFound[2].Name)
+	assert.Equal(t, "git+ssh://git@github.com/org/crypto-lib.git", packageFound[2].Version)
+	var got []string
+	for _, v := range policy.Check(append(found, packageFound...)) {
+		got = append(got, v.String())
+	}
+	assert.Equal(t, []string{
+		filepath.Join(dir, "vendored", "requirements.txt") + ":2: flask==1.0 comes from a denied source **/vendored/requirements.txt, policy policy.yml",
+		filepath.Join(dir, "web", "package.json") + ":5: lodash@^4.17.0 must pin an exact version, policy policy.yml",
+		filepath.Join(dir, "web", "package.json") + ":6: crypto-lib@git+ssh://git@github.com/org/crypto-lib.git must pin an exact version, policy policy.yml",
+		filepath.Join(dir, "web", "package.json") + ":6: crypto-lib@git+ssh://git@github.com/org/crypto-lib.git uses a denied source git+ssh://**, policy policy.yml",
+	}, got)
+}
+
+func TestPolicyCheckPipLines(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"requirements.txt": `-r base.txt
+git+https://github.com/dlitz/pycrypto.git#egg=pycrypto
+https://example.com/pycrypto-2.6.tar.gz#egg=pycrypto
+pycrypto @ https://example.com/pycrypto-2.6.tar.gz
+--index-url http://pypi.example.com/simple
+https://example.com/flask.tar.gz#egg=flask
+-r missing.txt
+flask==1.0
+`,
+		"base.txt": "-r requirements.txt\npycrypto==2.6\n",
+	})
+	defer os.RemoveAll(dir)
+	policy, err := ParsePolicy([]byte("deny:\n  pip: [pycrypto]\ndeny_sources:\n  - \"http://**\"\n  - \"https://example.com/flask*\"\n"), "policy.yml")
+	assert.Nil(t, err)
+
+	var got []string
+	for _, v := range policy.Check(RequirementsParser{Dir: dir}.ToolRequirements("pip")) {
+		got = append(got, v.String())
+	}
+	txt := filepath.Join(dir, "requirements.txt")
+	assert.Equal(t, []string{
+		txt + ":2: git+https://github.com/dlitz/pycrypto.git#egg=pycrypto is denied as pycrypto, policy policy.yml",
+		txt + ":3: https://example.com/pycrypto-2.6.tar.gz#egg=pycrypto is denied as pycrypto, policy policy.yml",
+		txt + ":4: pycrypto @ https://example.com/pycrypto-2.6.tar.gz is denied as pycrypto, policy policy.yml",
+		txt + ":5: --index-url http://pypi.example.com/simple uses a denied source http://**, policy policy.yml",
+		txt + ":6: https://example.com/flask.tar.gz#egg=flask uses a denied source https://example.com/flask*, policy policy.yml",
+		txt + ":7: -r missing.txt reads " + filepath.Join(dir, "missing.txt") + ", which can't be checked, policy policy.yml",
+		filepath.Join(dir, "base.txt") + ":2: pycrypto==2.6 is denied as pycrypto, policy policy.yml",
+	}, got)
+}
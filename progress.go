@@ -0,0 +1,109 @@
+package reqs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unicode/utf8"
+)
+
+// package tool output is shown as it's written, each line prefixed with
+// the tool.  On a terminal the lines replace each other on a single
+// progress line so a long install reads as one moving status
+
+type ProgressWriter struct {
+	Prefix string
+	Out    io.Writer
+	// overwrite one line instead of printing every line
+	Compact bool
+	// widest a compact line may be before it would wrap
+	Width   int
+	partial []byte
+	shown   bool
+}
+
+// a writer for tool's output to out, compact when out is a terminal
+func NewProgressWriter(tool string, out *os.File) *ProgressWriter {
+	return &ProgressWriter{
+		Prefix:  "[" + filepath.Base(tool) + "] ",
+		Out:     out,
+		Compact: IsTerminal(out),
+		Width:   terminalWidth(),
+	}
+}
+
+// from $COLUMNS, 80 when it isn't set
+func terminalWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// lines end with \n or \r, tools redraw progress bars with \r
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexAny(w.partial, "\r\n")
+		if i < 0 {
+			return len(p), nil
+		}
+		line := w.partial[:i]
+		w.partial = w.partial[i+1:]
+		if err := w.line(string(bytes.TrimSpace(line))); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (w *ProgressWriter) line(line string) error {
+	if line == "" {
+		return nil
+	}
+	line = w.Prefix + line
+	if !w.Compact {
+		_, err := io.WriteString(w.Out, line+"\n")
+		return err
+	}
+	w.shown = true
+	_, err := io.WriteString(w.Out, "\r\x1b[K"+truncate(line, w.Width-1))
+	return err
+}
+
+// write out what's left of the last line and clear the progress line
+func (w *ProgressWriter) Close() error {
+	if err := w.line(string(bytes.TrimSpace(w.partial))); err != nil {
+		return err
+	}
+	w.partial = nil
+	if w.shown {
+		w.shown = false
+		_, err := io.WriteString(w.Out, "\r\x1b[K")
+		return err
+	}
+	return nil
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width])
+}
+
+// run c with its stdout streamed under tool's name unless quiet
+func streamCommand(ctx context.Context, tool string, quiet bool, c Command) ([]byte, error) {
+	recordCommand(ctx, c)
+	if quiet {
+		return DefaultRunner.Run(ctx, c)
+	}
+	w := NewProgressWriter(tool, os.Stdout)
+	c.Stdout = w
+	out, err := DefaultRunner.Run(ctx, c)
+	w.Close()
+	return out, err
+}
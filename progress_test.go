@@ -0,0 +1,42 @@
+package reqs
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProgressWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &ProgressWriter{Prefix: "[apt] ", Out: &out}
+	w.Write([]byte("Reading package lists...\nSetting up "))
+	assert.Equal(t, "[apt] Reading package lists...\n", out.String())
+	w.Write([]byte("git ...\n\n50%\r100%"))
+	w.Close()
+	assert.Equal(t, "[apt] Reading package lists...\n[apt] Setting up git ...\n[apt] 50%\n[apt] 100%\n", out.String())
+
+	out.Reset()
+	w = &ProgressWriter{Prefix: "[apt] ", Out: &out, Compact: true, Width: 16}
+	w.Write([]byte("Unpacking git (1:2.17.1) ...\nDone\n"))
+	w.Close()
+	assert.Equal(t, "\r\x1b[K[apt] Unpacking\r\x1b[K[apt] Done\r\x1b[K", out.String())
+}
+
+func TestStreamedInstall(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Results["apt install"] = FakeResult{Stdout: "Setting up git (2.17.1) ...\n"}
+	var out bytes.Buffer
+	w := &ProgressWriter{Prefix: "[apt] ", Out: &out}
+	stdout, err := DefaultRunner.Run(context.Background(), Command{Argv: []string{"apt", "install", "git"}, Stdout: w})
+	assert.Nil(t, err)
+	assert.Equal(t, "Setting up git (2.17.1) ...\n", string(stdout))
+	assert.Equal(t, "[apt] Setting up git (2.17.1) ...\n", out.String())
+}
+
+func TestTailBuffer(t *testing.T) {
+	tail := tailBuffer{max: 10}
+	tail.Write([]byte("first line\nsecond\n"))
+	tail.Write([]byte("E: last\n"))
+	assert.Equal(t, "E: last\n", tail.String())
+}
@@ -0,0 +1,240 @@
+package reqs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// remote includes are fetched once into a local cache and used from
+// there.  Every remote include is pinned, files fetched over http(s)
+// by their sha256 and git refs by the commit they must be at, so a
+// changed baseline is refused rather than installed
+
+var (
+	sha256Pin = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	commitPin = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// the repositories git includes may clone, https, ssh and scp-like
+	// git@host:path remotes whose host can't pass for an option
+	gitRemote = regexp.MustCompile(`^(?:(?:https|ssh)://[^-/\s][^\s]*|git@[^-:/\s][^:/\s]*:[^\s]+)$`)
+)
+
+// largest file fetched over http(s) for an include
+var maxIncludeSize int64 = 10 << 20
+
+var includeClient = &http.Client{Timeout: time.Minute}
+
+// where remote includes are cached, $XDG_CACHE_HOME/reqs/includes, by
+// default in ~/.cache
+var DefaultIncludeCache = defaultIncludeCache()
+
+func defaultIncludeCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "reqs", "includes")
+}
+
+func (d *Discovery) cacheDir() string {
+	if d.CacheDir == "" {
+		return DefaultIncludeCache
+	}
+	return d.CacheDir
+}
+
+// check the pin of a remote include
+func (e includeEntry) checkPin() error {
+	switch {
+	case strings.HasPrefix(e.URL, "git+"):
+		if e.SHA256 != "" {
+			return errors.New("git includes are pinned with commit, not sha256")
+		}
+		if !commitPin.MatchString(e.Commit) {
+			return errors.New("git includes need the full commit hash the ref is at as commit")
+		}
+		if repo, ref, _ := parseGitInclude(e.URL); !gitRemote.MatchString(repo) || strings.HasPrefix(ref, "-") {
+			return errors.New("git includes must be git+https://, git+ssh:// or git+git@host:path urls")
+		}
+	case strings.HasPrefix(e.URL, "http://"), strings.HasPrefix(e.URL, "https://"):
+		if e.Commit != "" {
+			return errors.New("http includes are pinned with sha256, not commit")
+		}
+		if !sha256Pin.MatchString(e.SHA256) {
+			return errors.New("http includes need the sha256 of the file as sha256")
+		}
+	default:
+		return errors.New("remote includes must be http://, https:// or git+ urls")
+	}
+	return nil
+}
+
+// the cached copy of a remote include, fetched first unless d.Offline
+func (d *Discovery) fetchInclude(ctx context.Context, e includeEntry) (string, error) {
+	if err := e.checkPin(); err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(e.URL, "git+") {
+		return d.fetchGit(ctx, e)
+	}
+	return d.fetchHTTP(ctx, e)
+}
+
+func (d *Discovery) fetchHTTP(ctx context.Context, e includeEntry) (string, error) {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		name = "reqs.yml"
+	}
+	dir := filepath.Join(d.cacheDir(), "http", e.SHA256)
+	cached := filepath.Join(dir, name)
+	if b, err := ioutil.ReadFile(cached); err == nil && sha256Hex(b) == e.SHA256 {
+		d.report("Using " + cached + " cached for " + e.URL)
+		return cached, nil
+	}
+	if d.Offline {
+		return "", errors.New("it isn't cached and reqs is offline")
+	}
+	d.report("Fetching " + e.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := includeClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("fetching it returned " + resp.Status)
+	}
+	// one byte past the limit tells a file that's too large from one
+	// that's exactly the limit
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxIncludeSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(b)) > maxIncludeSize {
+		return "", errors.New("it is larger than " + strconv.FormatInt(maxIncludeSize, 10) + " bytes")
+	}
+	if sum := sha256Hex(b); sum != e.SHA256 {
+		return "", errors.New("its sha256 is " + sum + ", expected " + e.SHA256)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return cached, writeFileAtomic(cached, b)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// write through a temporary file so a cache entry is never half written
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".fetch-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// the repository, ref and file of git+<repository>[@ref][#path], the
+// file defaults to reqs.yml and the ref to the remote HEAD
+func parseGitInclude(rawURL string) (repo, ref, file string) {
+	repo = strings.TrimPrefix(rawURL, "git+")
+	file = "reqs.yml"
+	if i := strings.Index(repo, "#"); i != -1 {
+		repo, file = repo[:i], repo[i+1:]
+	}
+	// the user of a git@host:path remote isn't a ref
+	start := strings.LastIndex(repo, "/")
+	if i := strings.Index(repo, ":"); strings.HasPrefix(repo, "git@") && i > start {
+		start = i
+	}
+	if i := strings.LastIndex(repo, "@"); i > start {
+		repo, ref = repo[:i], repo[i+1:]
+	}
+	return repo, ref, file
+}
+
+func (d *Discovery) fetchGit(ctx context.Context, e includeEntry) (string, error) {
+	repo, ref, file := parseGitInclude(e.URL)
+	if file = path.Clean(file); file == ".." || strings.HasPrefix(file, "../") || path.IsAbs(file) {
+		return "", errors.New(file + " is outside the repository")
+	}
+	dir := filepath.Join(d.cacheDir(), "git", e.Commit)
+	cached := filepath.Join(dir, filepath.FromSlash(file))
+	if head, err := gitHead(ctx, dir); err == nil && head == e.Commit {
+		d.report("Using " + cached + " cached for " + e.URL)
+		return cached, nil
+	}
+	if d.Offline {
+		return "", errors.New("it isn't cached and reqs is offline")
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".clone-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	d.report("Cloning " + repo + " for " + e.URL)
+	argv := []string{"git", "clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		argv = append(argv, "--branch", ref)
+	}
+	// never prompt for credentials, passphrases or host keys, reqs isn't
+	// attached to the terminal
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	// checkPin only lets remotes through, -- keeps them from being options
+	argv = append(argv, "--", repo, tmp)
+	if _, err := DefaultRunner.Run(ctx, Command{Argv: argv, Env: env}); err != nil {
+		return "", err
+	}
+	head, err := gitHead(ctx, tmp)
+	if err != nil {
+		return "", err
+	}
+	if head != e.Commit {
+		return "", errors.New("it is at commit " + head + ", expected " + e.Commit)
+	}
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", err
+	}
+	return cached, nil
+}
+
+func gitHead(ctx context.Context, dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return "", err
+	}
+	out, err := commandOutput(ctx, "git", "-C", dir, "rev-parse", "HEAD")
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,167 @@
+package reqs
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHTTPInclude(t *testing.T) {
+	baseline := "common:\n  - git\n"
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write([]byte(baseline))
+	}))
+	defer server.Close()
+	pin := sha256Hex([]byte(baseline))
+
+	dir := writeTestFiles(t, map[string]string{
+		"good/reqs.yml":     "include:\n  - url: " + server.URL + "/base/reqs.yml\n    sha256: " + pin + "\n",
+		"tampered/reqs.yml": "include:\n  - url: " + server.URL + "/reqs.yml\n    sha256: " + strings.Repeat("0", 64) + "\n",
+		"unpinned/reqs.yml": "include:\n  - " + server.URL + "/reqs.yml\n",
+	})
+	defer os.RemoveAll(dir)
+	d := &Discovery{MaxDepth: -1, CacheDir: filepath.Join(dir, "cache")}
+
+	// an interrupted run stops fetching
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceled := &Discovery{MaxDepth: -1, CacheDir: d.CacheDir, Context: ctx}
+	_, err := canceled.Expand(dir, []RequirementsFile{{Path: filepath.Join(dir, "good", "reqs.yml"), Kind: KindReqsYml}})
+	assert.Contains(t, err.Error(), "context canceled")
+	assert.Equal(t, 0, fetches)
+
+	files, err := d.Expand(dir, []RequirementsFile{{Path: filepath.Join(dir, "good", "reqs.yml"), Kind: KindReqsYml}})
+	assert.Nil(t, err)
+	cached := filepath.Join(dir, "cache", "http", pin, "reqs.yml")
+	assert.Equal(t, []RequirementsFile{
+		{Path: filepath.Join(dir, "good", "reqs.yml"), Kind: KindReqsYml},
+		{Path: cached, Kind: KindReqsYml},
+	}, files)
+
+	// offline uses the cache
+	d.Offline = true
+	_, err = d.Expand(dir, files[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fetches)
+
+	_, err = d.Expand(dir, []RequirementsFile{{Path: filepath.Join(dir, "tampered", "reqs.yml"), Kind: KindReqsYml}})
+	assert.EqualError(t, err, filepath.Join(dir, "tampered", "reqs.yml")+": can't include "+server.URL+"/reqs.yml, it isn't cached and reqs is offline")
+
+	d.Offline = false
+	_, err = d.Expand(dir, []RequirementsFile{{Path: filepath.Join(dir, "tampered", "reqs.yml"), Kind: KindReqsYml}})
+	assert.Contains(t, err.Error(), "its sha256 is "+pin+", expected 000")
+
+	_, err = d.Expand(dir, []RequirementsFile{{Path: filepath.Join(dir, "unpinned", "reqs.yml"), Kind: KindReqsYml}})
+	assert.Contains(t, err.Error(), "http includes need the sha256 of the file as sha256")
+	assert.Equal(t, 2, fetches)
+
+	unpinned := filepath.Join(dir, "unpinned", "reqs.yml")
+	assert.Equal(t, []Diagnostic{{File: unpinned, Line: 2, Message: "include " + server.URL + "/reqs.yml: http includes need the sha256 of the file as sha256"}}, LintFile(unpinned))
+
+	// a file past the size limit is reported as too large, not as a file
+	// that doesn't match its pin
+	defer func(max int64) { maxIncludeSize = max }(maxIncludeSize)
+	maxIncludeSize = int64(len(baseline) - 1)
+	d.CacheDir = filepath.Join(dir, "cache-small")
+	_, err = d.Expand(dir, []RequirementsFile{{Path: filepath.Join(dir, "good", "reqs.yml"), Kind: KindReqsYml}})
+	assert.Contains(t, err.Error(), "it is larger than 15 bytes")
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=reqs", "-c", "user.email=reqs@example.com"}, args...)...)
+	out, err := cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func TestGitInclude(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := writeTestFiles(t, map[string]string{
+		"repo/base/reqs.yml":             "include:\n  - apt-requirements.txt\n",
+		"repo/base/apt-requirements.txt": "curl\n",
+	})
+	defer os.RemoveAll(dir)
+	repo := filepath.Join(dir, "repo")
+	git(t, repo, "init", "-q", "-b", "main")
+	git(t, repo, "add", ".")
+	git(t, repo, "commit", "-q", "-m", "baseline")
+	commit := git(t, repo, "rev-parse", "HEAD")
+	// a local repository stands in for a remote one
+	defer func(remote *regexp.Regexp) { gitRemote = remote }(gitRemote)
+	gitRemote = regexp.MustCompile(`^file://`)
+
+	url := "git+file://" + filepath.ToSlash(repo) + "@main#base/reqs.yml"
+	yml := filepath.Join(dir, "reqs.yml")
+	assert.Nil(t, ioutil.WriteFile(yml, []byte("include:\n  - url: "+url+"\n    commit: "+commit+"\n"), 0644))
+	d := &Discovery{MaxDepth: -1, CacheDir: filepath.Join(dir, "cache")}
+
+	files, err := d.Expand(dir, []RequirementsFile{{Path: yml, Kind: KindReqsYml}})
+	assert.Nil(t, err)
+	cached := filepath.Join(dir, "cache", "git", commit, "base")
+	assert.Equal(t, []RequirementsFile{
+		{Path: yml, Kind: KindReqsYml},
+		{Path: filepath.Join(cached, "reqs.yml"), Kind: KindReqsYml},
+		{Path: filepath.Join(cached, "apt-requirements.txt"), Kind: KindToolRequirements, Tool: "apt"},
+	}, files)
+
+	// the ref moved on from the pinned commit
+	assert.Nil(t, os.RemoveAll(filepath.Join(dir, "cache")))
+	git(t, repo, "commit", "-q", "--allow-empty", "-m", "moved")
+	_, err = d.Expand(dir, files[:1])
+	assert.Contains(t, err.Error(), "expected "+commit)
+
+	assert.Equal(t, []string{"https://example.com/repo.git", "v1", "reqs.yml"}, parseGit("git+https://example.com/repo.git@v1"))
+	assert.Equal(t, []string{"ssh://git@example.com/repo.git", "", "a/reqs.yml"}, parseGit("git+ssh://git@example.com/repo.git#a/reqs.yml"))
+	assert.Equal(t, []string{"git@example.com:repo.git", "v1", "reqs.yml"}, parseGit("git+git@example.com:repo.git@v1"))
+}
+
+func TestGitIncludeRemotes(t *testing.T) {
+	commit := strings.Repeat("a", 40)
+	for _, url := range []string{
+		"git+https://example.com/repo.git",
+		"git+ssh://git@example.com/repo.git@v1",
+		"git+git@example.com:org/repo.git#a/reqs.yml",
+	} {
+		assert.Nil(t, includeEntry{URL: url, Commit: commit}.checkPin(), url)
+	}
+	for _, url := range []string{
+		"git+--upload-pack=touch /tmp/pwned",
+		"git+ext::sh -c touch% /tmp/pwned",
+		"git+file:///tmp/repo",
+		"git+ssh://-oProxyCommand=id/repo.git",
+		"git+https://example.com/repo.git@--upload-pack=id",
+	} {
+		assert.NotNil(t, includeEntry{URL: url, Commit: commit}.checkPin(), url)
+	}
+
+	// ssh never stops to ask for a passphrase or to accept a host key
+	fake := useFakeRunner(t)
+	fake.Results["git clone"] = FakeResult{Stderr: "fatal: Could not read from remote repository.", ExitCode: 128}
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml": "include:\n  - url: git+ssh://git@example.com/repo.git\n    commit: " + commit + "\n",
+	})
+	defer os.RemoveAll(dir)
+	d := &Discovery{MaxDepth: -1, CacheDir: filepath.Join(dir, "cache")}
+	_, err := d.Expand(dir, []RequirementsFile{{Path: filepath.Join(dir, "reqs.yml"), Kind: KindReqsYml}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(fake.Calls))
+	assert.Contains(t, fake.Calls[0].Env, "GIT_TERMINAL_PROMPT=0")
+	assert.Contains(t, fake.Calls[0].Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+}
+
+func parseGit(url string) []string {
+	repo, ref, file := parseGitInclude(url)
+	return []string{repo, ref, file}
+}
@@ -2,70 +2,146 @@ package reqs
 
 import (
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 )
 
-func testReqsOn(arch, reqsArgsStr string) error {
-	vm := VagrantSystem{
-		Arch:   arch,
-		Status: "",
+// integration tests running reqs on each system in test-targets.yml,
+// locally with fakepm unless REQS_TEST_TARGETS is container or vagrant
+
+// the examples the Vagrantfile provisions
+var targetSources = []string{
+	"examples/data-service",
+	"examples/web-service",
+	"examples/flask-service",
+	"examples/pip3-setup",
+}
+
+var (
+	buildOnce sync.Once
+	binDir    string
+	buildErr  error
+)
+
+// build reqs and fakepm for linux into a temp directory once per run
+func buildTargetBinaries(t *testing.T) string {
+	buildOnce.Do(func() {
+		if binDir, buildErr = ioutil.TempDir("", "reqs-bin-"); buildErr != nil {
+			return
+		}
+		build := exec.Command("go", "build", "-o", binDir, "./cmd/reqs", "./cmd/fakepm")
+		build.Env = append(os.Environ(), "CGO_ENABLED=0")
+		out, err := build.CombinedOutput()
+		if err != nil {
+			buildErr = err
+			t.Log(string(out))
+		}
+	})
+	if buildErr != nil {
+		t.Fatal(buildErr)
+	}
+	return binDir
+}
+
+func testTarget(t *testing.T, name string) Target {
+	configs, err := LoadTargetConfigs("test-targets.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, ok := configs[name]
+	if !ok {
+		t.Fatal("no target " + name + " in test-targets.yml")
 	}
-	vm.Down()
-	err := vm.Run("reqs " + reqsArgsStr)
-	vm.Down()
-	return err
+	switch kind := os.Getenv("REQS_TEST_TARGETS"); kind {
+	case "", "local":
+		return &LocalTarget{Config: config, BinDir: buildTargetBinaries(t), Sources: targetSources}
+	case "container":
+		if config.Image == "" {
+			t.Skip("no image for " + name)
+		}
+		if ContainerEngine(nil) == "" {
+			t.Skip("podman or docker not found")
+		}
+		if runtime.GOOS != "linux" {
+			t.Skip("container targets need reqs built on linux")
+		}
+		return &ContainerTarget{Name: name, Config: config, Binary: filepath.Join(buildTargetBinaries(t), "reqs"), Sources: targetSources}
+	case "vagrant":
+		if config.Vagrant == "" {
+			t.Skip("no vagrant machine for " + name)
+		}
+		if !IsCommandAvailable("vagrant") {
+			t.Skip("vagrant not found")
+		}
+		return &VagrantTarget{Machine: config.Vagrant}
+	default:
+		t.Fatal("unknown REQS_TEST_TARGETS " + kind + ", expected local, container or vagrant")
+	}
+	return nil
+}
+
+func testReqsOn(t *testing.T, name, reqsArgsStr string) error {
+	target := testTarget(t, name)
+	defer target.Down()
+	return target.Reqs(strings.Fields(reqsArgsStr)...)
 }
 
 // test basic apt
 func TestReqsApt(t *testing.T) {
-	err := testReqsOn("ubuntu", "-r")
+	err := testReqsOn(t, "ubuntu", "install -r")
 	assert.Nil(t, err)
 }
 
 // also test pip3 with update and upgrade
 func TestReqsUbuntuPip3(t *testing.T) {
 	// test with pip and pip3 update and upgrade
-	err := testReqsOn("ubuntu", "-d pip3-setup -up -spip3")
+	err := testReqsOn(t, "ubuntu", "install -d pip3-setup -up -spip3")
 	assert.Nil(t, err)
 }
 
 func TestReqsUbuntuNpm(t *testing.T) {
-	err := testReqsOn("ubuntu", "-d web-service -snpm")
+	err := testReqsOn(t, "ubuntu", "install -d web-service -snpm")
 	assert.Nil(t, err)
 }
 
 // test basic dnf
 func TestReqsDnf(t *testing.T) {
-	err := testReqsOn("fedora", "-r")
+	err := testReqsOn(t, "fedora", "install -r")
 	assert.Nil(t, err)
 }
 
 // also tests update and upgrade
 func TestReqsFedoraPip3(t *testing.T) {
-	err := testReqsOn("fedora", "-d pip3-setup -up -spip3")
+	err := testReqsOn(t, "fedora", "install -d pip3-setup -up -spip3")
 	assert.Nil(t, err)
 }
 
 // test basic brew
 func TestReqsBrew(t *testing.T) {
-	err := testReqsOn("osx", "-r")
+	err := testReqsOn(t, "osx", "install -r")
 	assert.Nil(t, err)
 }
 
 // test osx with npm
 func TestReqsOsxNpm(t *testing.T) {
-	err := testReqsOn("osx", "-d web-service -npm")
+	err := testReqsOn(t, "osx", "install -d web-service -npm")
 	assert.Nil(t, err)
 }
 
 // test osx with pip3
 // func TestReqsOsxPip3(t *testing.T) {
-// 	err := testReqsOn("osx", "-d pip3-service -pip3")
+// 	err := testReqsOn(t, "osx", "install -d pip3-service -pip3")
 // 	assert.Nil(t, err)
 // }
 
 // test basic yum
 func TestReqsYum(t *testing.T) {
-	err := testReqsOn("centos", "-r")
+	err := testReqsOn(t, "centos", "install -r")
 	assert.Nil(t, err)
 }
@@ -1,13 +1,14 @@
 package reqs
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"runtime"
 	"strings"
 )
@@ -15,82 +16,385 @@ import (
 // requirements for parsing requirements files
 // and for determining currently installed requirements
 
-func recurseForFiles(dir string, fnames []string) (filePaths []string) {
-	filepathList := []string{}
-	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-		filepathList = append(filepathList, path)
-		return nil
-	})
+// find requirements files by exact name with DefaultDiscovery, followed
+// by the files their reqs.yml files include
+func findRequirementsFiles(dirPath string, recurse bool) []RequirementsFile {
+	files, err := DefaultDiscovery.Find(dirPath, recurse)
+	FatalCheck(err)
+	files, err = DefaultDiscovery.Expand(dirPath, files)
 	FatalCheck(err)
+	return files
+}
 
-	for _, path := range filepathList {
-		if StringContainedInSlice(path, fnames) {
-			filePaths = append(filePaths, path)
-		}
+// the files a reqs.yml document read from source includes, signed
+// relative to the working directory like source
+func includedFiles(b []byte, source string) []RequirementsFile {
+	files, err := DefaultDiscovery.Included(".", source, b)
+	FatalCheck(err)
+	return files
+}
+
+// read a requirements file named with -f, checking its signature
+// relative to the working directory
+func readRequirementsFile(path string) []byte {
+	FatalCheck(DefaultDiscovery.Verify(".", []RequirementsFile{{Path: path}}))
+	return readRequirements(path)
+}
+
+// read a discovered requirements file, the contents that were verified
+// when signatures are required
+func readRequirements(path string) []byte {
+	b, err := DefaultDiscovery.readFile(path)
+	FatalCheck(err)
+	return b
+}
+
+// read requirements from stdin, which can't be signed
+func readRequirementsStdin() []byte {
+	if DefaultDiscovery.RequireSigned {
+		log.Fatal("Requirements from stdin can't be signed, they're refused when signatures are required")
 	}
-	return filePaths
+	b, err := ioutil.ReadAll(os.Stdin)
+	FatalCheck(err)
+	return b
 }
 
 func GetRequirementFilenames(dirPath string, recurse bool) (fileNames []string) {
-	requirementFilenames := []string{
-		"requirements.txt",
-		"reqs.yml",
+	for _, rf := range findRequirementsFiles(dirPath, recurse) {
+		fileNames = append(fileNames, rf.Path)
 	}
-	if recurse {
-		fileNames = recurseForFiles(dirPath, requirementFilenames)
-	} else {
-		files, err := ioutil.ReadDir(dirPath)
-		FatalCheck(err)
-		for _, f := range files {
-			joinArg := ""
-			if !strings.HasSuffix(dirPath, "/") {
-				joinArg = "/"
+	return fileNames
+}
+
+func ymlToMap(ymlPath string) (conf map[string][]ymlEntry) {
+	return ymlBytesToMap(readRequirements(ymlPath), ymlPath)
+}
+
+// source names the document in error messages, the include section is
+// left out since its entries aren't packages
+func ymlBytesToMap(b []byte, source string) (conf map[string][]ymlEntry) {
+	sections := make(map[string]ymlSection)
+	err := yaml.Unmarshal(b, &sections)
+	conf = make(map[string][]ymlEntry)
+	for name, section := range sections {
+		if err != nil || name == includeKey {
+			continue
+		}
+		var entries []ymlEntry
+		err = section.unmarshal(&entries)
+		conf[name] = entries
+	}
+	if err != nil {
+		log.Fatal(source + ": " + err.Error() + ", run reqs lint for details")
+	}
+	return conf
+}
+
+// a reqs.yml section decoded once its name is known
+type ymlSection struct {
+	unmarshal func(interface{}) error
+}
+
+func (s *ymlSection) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	s.unmarshal = unmarshal
+	return nil
+}
+
+// a reqs.yml list entry, one or more packages, `optional: pkg` for a
+// package some releases don't have or `any-of: [pkg, ...]` for
+// alternatives tried in order
+type ymlEntry struct {
+	Packages string
+	Optional bool
+	AnyOf    []string
+}
+
+func (e *ymlEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&e.Packages); err == nil {
+		return nil
+	}
+	var m struct {
+		Optional string   `yaml:"optional"`
+		AnyOf    []string `yaml:"any-of"`
+	}
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+	switch {
+	case m.Optional != "" && len(m.AnyOf) == 0:
+		e.Packages, e.Optional = m.Optional, true
+	case m.Optional == "" && len(m.AnyOf) > 0:
+		e.AnyOf = m.AnyOf
+	default:
+		return errors.New("expected a package, optional: package or any-of: [packages]")
+	}
+	return nil
+}
+
+// the packages of the entry for sections without optional and
+// alternative packages, the first alternative of any-of
+func (e ymlEntry) String() string {
+	if len(e.AnyOf) > 0 {
+		return e.AnyOf[0]
+	}
+	return e.Packages
+}
+
+func (e ymlEntry) requirements(tool, source string) (found []Requirement) {
+	if len(e.AnyOf) > 0 {
+		r := NewRequirement(e.AnyOf[0], tool)
+		r.Source = source
+		r.Alternatives = e.AnyOf
+		return []Requirement{r}
+	}
+	for _, r := range parseRequirementsText(e.Packages, tool, source) {
+		r.Optional = e.Optional
+		found = append(found, r)
+	}
+	return found
+}
+
+// whether text is a reqs.yml document rather than a plain requirements
+// list, decided by the first line that is not blank or a comment
+func isReqsYml(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		return trimmed == "---" || strings.HasSuffix(trimmed, ":") || strings.Contains(trimmed, ": ")
+	}
+	return false
+}
+
+// a single package entry and where it was found
+type Requirement struct {
+	Name    string `json:"package" yaml:"package"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	Tool    string `json:"tool" yaml:"tool"`
+	Section string `json:"section,omitempty" yaml:"section,omitempty"`
+	Source  string `json:"source,omitempty" yaml:"source,omitempty"`
+	Line    int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Status  string `json:"status,omitempty" yaml:"status,omitempty"`
+	// why the package failed to install
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// skipped rather than failed when the tool doesn't have it
+	Optional bool `json:"optional,omitempty" yaml:"optional,omitempty"`
+	// any-of packages, Name is the one chosen to install
+	Alternatives []string `json:"alternatives,omitempty" yaml:"alternatives,omitempty"`
+	// the entry as written, passed to the package tool when installing
+	spec string
+}
+
+func NewRequirement(spec, tool string) Requirement {
+	name, version := splitVersion(spec, tool)
+	return Requirement{Name: name, Version: version, Tool: tool, spec: spec}
+}
+
+// the requirement for one of r's alternatives, from where r was found
+func (r Requirement) choose(spec string) Requirement {
+	c := NewRequirement(spec, r.Tool)
+	c.Section, c.Source, c.Line = r.Section, r.Source, r.Line
+	c.Optional, c.Alternatives = r.Optional, r.Alternatives
+	return c
+}
+
+func (r Requirement) Spec() string {
+	if r.spec != "" {
+		return r.spec
+	}
+	if r.Version != "" {
+		return r.Name + "=" + r.Version
+	}
+	return r.Name
+}
+
+// split a package entry into name and version using the version syntax
+// of the tool, pip keeps comparison operators other than == in the version
+// and names urls by their #egg= or name @, options are kept whole
+func splitVersion(spec, tool string) (name, version string) {
+	switch tool {
+	case "pip", "pip3":
+		if name, ok := pipURLName(spec); ok {
+			return name, ""
+		}
+		if strings.HasPrefix(spec, "-") {
+			return spec, ""
+		}
+		// environment markers and hashes aren't part of the version
+		if i := strings.Index(spec, ";"); i > 0 {
+			spec = spec[:i]
+		}
+		if i := strings.Index(spec, " --"); i > 0 {
+			spec = spec[:i]
+		}
+		spec = strings.TrimSpace(spec)
+		if i := strings.IndexAny(spec, "=<>!~"); i > 0 {
+			return strings.TrimSpace(spec[:i]), strings.TrimPrefix(strings.TrimSpace(spec[i:]), "==")
+		}
+	case "npm":
+		// scoped packages start with @
+		if i := strings.LastIndex(spec, "@"); i > 0 {
+			return spec[:i], spec[i+1:]
+		}
+	default:
+		if i := strings.Index(spec, "="); i > 0 {
+			return spec[:i], spec[i+1:]
+		}
+	}
+	return spec, ""
+}
+
+// parse requirements text, one or more packages per line with # comments,
+// pip lines are kept whole since they can hold specifiers and options
+func parseRequirementsText(text, tool, source string) (found []Requirement) {
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lineNo := i + 1
+		entries := strings.Fields(line)
+		if tool == "pip" || tool == "pip3" {
+			// pip joins a line ending in \ with the next, hashes are
+			// usually given that way
+			for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+				i++
+				line = strings.TrimSpace(strings.TrimSuffix(line, "\\")) + " " + strings.TrimSpace(lines[i])
 			}
-			fileNames = append(fileNames, dirPath+joinArg+f.Name())
+			entries = []string{line}
+		}
+		for _, entry := range entries {
+			r := NewRequirement(entry, tool)
+			r.Source = source
+			r.Line = lineNo
+			found = append(found, r)
 		}
 	}
-	return fileNames
+	return found
 }
 
-func ymlToMap(ymlPath string) (conf map[string][]string) {
-	b, err := ioutil.ReadFile(ymlPath)
-	FatalCheck(err)
-	m := make(map[string][]string)
-	err = yaml.Unmarshal(b, &m)
-	FatalCheck(err)
-	return m
+// read the requirements in the given sections of a reqs.yml file, each
+// requirement is installed with tool and records the section it came from
+func ymlRequirements(ymlPath, tool string, sections ...string) (found []Requirement) {
+	return parseYmlRequirements(readRequirements(ymlPath), ymlPath, tool, sections...)
 }
 
-// find tool-requirements.txt, common-requirements.txt and/or reqs.yml
-// in the specified directory, can recurse down the directory
-func getSysRequirements(dirPath, packageTool string, recurse bool) (text string) {
-	fileNames := GetRequirementFilenames(dirPath, recurse)
-	toolRequirements := packageTool + "-requirements.txt"
-	const commonRequirements = "common-requirements.txt"
-	const reqsYml = "reqs.yml"
-
-	for _, fname := range fileNames {
-		if strings.Contains(fname, commonRequirements) || strings.Contains(fname, toolRequirements) {
-			log.Info("Found " + fname)
-			b, err := ioutil.ReadFile(fname)
-			FatalCheck(err)
-			text = AppendNewLinesOnly(text, string(b))
-		} else if strings.Contains(fname, reqsYml) {
-			log.Info("Found " + fname)
-			conf := ymlToMap(fname)
-			for tool, packages := range conf {
-				if tool == "common" || tool == packageTool {
-					for _, p := range packages {
-						text = AppendNewLinesOnly(text, string(p))
-					}
-				}
+func parseYmlRequirements(b []byte, source, tool string, sections ...string) (found []Requirement) {
+	conf := ymlBytesToMap(b, source)
+	lines := ymlItemLines(string(b))
+	for _, section := range sections {
+		for i, e := range conf[section] {
+			for _, r := range e.requirements(tool, source) {
+				r.Section = section
+				r.Line = nthLine(lines[section], i)
+				found = append(found, r)
 			}
 		}
 	}
-	if len(text) == 0 {
+	return found
+}
+
+// best effort line numbers of each section's list items in order, reqs.yml
+// is a flat mapping of sections to lists so a line scan suffices.  Items
+// of nested lists, like a block style any-of, are indented further and
+// skipped
+func ymlItemLines(text string) map[string][]int {
+	lines := make(map[string][]int)
+	section, indent := "", -1
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "-") {
+			section, indent = strings.TrimSpace(strings.SplitN(line, ":", 2)[0]), -1
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "-") {
+			continue
+		}
+		itemIndent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == -1 {
+			indent = itemIndent
+		}
+		if itemIndent == indent {
+			lines[section] = append(lines[section], i+1)
+		}
+	}
+	return lines
+}
+
+func ymlPackages(entries []ymlEntry) (packages []string) {
+	for _, e := range entries {
+		packages = append(packages, e.String())
+	}
+	return packages
+}
+
+// the line of the nth item of a section, 0 when unknown
+func nthLine(lines []int, n int) int {
+	if n < len(lines) {
+		return lines[n]
+	}
+	return 0
+}
+
+// join requirements into the newline separated text the install steps use,
+// dropping duplicate entries
+func joinRequirements(found []Requirement) (text string) {
+	var specs []string
+	for _, r := range found {
+		specs = appendUnique(specs, r.Spec())
+	}
+	return strings.Join(specs, "\n")
+}
+
+// requirements one a line, as PipInstall reads them
+func RequirementLines(found []Requirement) string {
+	var lines []string
+	for _, r := range found {
+		lines = appendUnique(lines, pipLine(r))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// space separated requirements as passed to a package tool install
+func RequirementsList(found []Requirement) string {
+	return strings.Replace(joinRequirements(found), "\n", " ", -1)
+}
+
+// find tool-requirements.txt, common-requirements.txt and/or reqs.yml
+// in the specified directory, can recurse down the directory
+func findSysRequirements(dirPath, packageTool string, recurse bool) (found []Requirement) {
+	for _, rf := range findRequirementsFiles(dirPath, recurse) {
+		found = append(found, sysRequirementsIn(rf, packageTool)...)
+	}
+	if len(found) == 0 {
 		log.Warn("No system requirements files found")
 	}
-	return strings.TrimSpace(text)
+	return found
+}
+
+// the system requirements for packageTool in one requirements file
+func sysRequirementsIn(rf RequirementsFile, packageTool string) (found []Requirement) {
+	switch {
+	case rf.Kind == KindToolRequirements && (rf.Tool == "common" || rf.Tool == packageTool):
+		log.Info("Found " + rf.Path)
+		found = parseRequirementsText(string(readRequirements(rf.Path)), packageTool, rf.Path)
+	case rf.Kind == KindReqsYml:
+		log.Info("Found " + rf.Path)
+		found = ymlRequirements(rf.Path, packageTool, "common", packageTool)
+	case rf.Kind == KindBrewfile && packageTool == "brew":
+		log.Info("Found " + rf.Path)
+		found = parseRequirementsText(ParseBrewfile(string(readRequirements(rf.Path))), packageTool, rf.Path)
+	}
+	return found
+}
+
+func getSysRequirements(dirPath, packageTool string, recurse bool) (text string) {
+	return joinRequirements(findSysRequirements(dirPath, packageTool, recurse))
 }
 
 func getSysRequirementsMultipleDirs(dirPaths []string, packageTool string, recurse bool) (reqs string) {
@@ -106,6 +410,13 @@ type RequirementsParser struct {
 	WithVersion         bool
 	Recurse             bool
 	Sources             bool
+	// text, json or yaml for listings
+	Format string
+	// the section plain requirements read from File or stdin belong to,
+	// the package tool when empty
+	InputTool string
+	// the package tool to use instead of detecting one
+	PackageTool string
 }
 
 func (rp RequirementsParser) FindNpmPackageDirs() (packageDirs []string) {
@@ -117,18 +428,58 @@ func (rp RequirementsParser) FindNpmPackageDirs() (packageDirs []string) {
 	return packageDirs
 }
 
-func (rp RequirementsParser) ListInstalled(packageTool string) (requirements string) {
+func (rp RequirementsParser) ListInstalled(ctx context.Context, packageTool string) (requirements string) {
 	switch packageTool {
 	case "apt":
-		requirements = AptListInstalled(rp.WithVersion)
+		requirements = AptListInstalled(ctx, rp.WithVersion)
 	case "brew":
-		requirements = BrewListInstalled()
+		requirements = BrewListInstalled(ctx)
 	case "dnf":
-		requirements = DnfListInstalled(rp.WithVersion)
+		requirements = DnfListInstalled(ctx, rp.WithVersion)
+	case FakeTool:
+		requirements = FakepmListInstalled(ctx, rp.WithVersion)
 	}
 	return requirements
 }
 
+// the currently installed packages as requirements with status installed
+func (rp RequirementsParser) InstalledRequirements(ctx context.Context, packageTool string) (found []Requirement) {
+	for _, r := range parseRequirementsText(rp.ListInstalled(ctx, packageTool), packageTool, "") {
+		r.Status = StatusInstalled
+		found = append(found, r)
+	}
+	return found
+}
+
+// mark each requirement installed or missing against the installed
+// packages, any-of requirements are installed when any alternative is and
+// missing optional requirements aren't counted
+func (rp RequirementsParser) Check(ctx context.Context, packageTool string, found []Requirement) (checked []Requirement, missing int) {
+	installed := make(map[string]bool)
+	for _, r := range parseRequirementsText(rp.ListInstalled(ctx, packageTool), packageTool, "") {
+		installed[r.Name] = true
+		// dnf lists packages as name.arch
+		if i := strings.LastIndex(r.Name, "."); i > 0 && (emulatedTool(packageTool) == "dnf" || emulatedTool(packageTool) == "yum") {
+			installed[r.Name[:i]] = true
+		}
+	}
+	for _, r := range found {
+		r.Status = StatusMissing
+		for _, name := range append([]string{r.Name}, r.Alternatives...) {
+			if installed[name] {
+				r = r.choose(name)
+				r.Status = StatusInstalled
+				break
+			}
+		}
+		if r.Status == StatusMissing && !r.Optional {
+			missing++
+		}
+		checked = append(checked, r)
+	}
+	return checked, missing
+}
+
 func amIRoot() bool {
 	if os.Geteuid() == 0 {
 		return true
@@ -137,7 +488,10 @@ func amIRoot() bool {
 }
 
 // determine the package tool, sudo and autoYes based on the current system
-func (rp RequirementsParser) parseTooling() (sudo, packageTool, autoYes string) {
+func (rp RequirementsParser) parseTooling(ctx context.Context) (sudo, packageTool, autoYes string) {
+	if rp.PackageTool != "" {
+		return rp.chosenTooling()
+	}
 	switch runtime.GOOS {
 	case "linux":
 		if !rp.UseStdout {
@@ -166,7 +520,7 @@ func (rp RequirementsParser) parseTooling() (sudo, packageTool, autoYes string)
 			log.Info("Darwin system detected")
 		}
 		if !IsCommandAvailable("brew") {
-			InstallHomebrew()
+			InstallHomebrew(ctx)
 		}
 		packageTool = "brew"
 	case "windows":
@@ -177,129 +531,258 @@ func (rp RequirementsParser) parseTooling() (sudo, packageTool, autoYes string)
 	return sudo, packageTool, autoYes
 }
 
+// sudo and autoYes for the package tool given in rp.PackageTool
+func (rp RequirementsParser) chosenTooling() (sudo, packageTool, autoYes string) {
+	packageTool = rp.PackageTool
+	if !StringInSlice(packageTool, PackageTools) {
+		log.Fatal("Unsupported package tool " + packageTool + ", expected one of " + strings.Join(PackageTools, ", "))
+	}
+	if !IsCommandAvailable(packageTool) {
+		log.Fatal("Package tool " + packageTool + " not found")
+	}
+	if packageTool == "brew" {
+		return "", packageTool, ""
+	}
+	// fakepm only touches its state file
+	if !amIRoot() && packageTool != FakeTool {
+		sudo = "sudo "
+	}
+	return sudo, packageTool, "-y "
+}
+
+// determine the package tool, sudo and autoYes based on the current system
+func (rp RequirementsParser) Tooling(ctx context.Context) (sudo, packageTool, autoYes string) {
+	return rp.parseTooling(ctx)
+}
+
+// write the apt sources or brew taps of packageTool in rp.Format
+func (rp RequirementsParser) WriteSources(ctx context.Context, w io.Writer, packageTool string) error {
+	sources := ""
+	switch packageTool {
+	case "apt":
+		sources = GetAptSources()
+	case "brew":
+		sources = GetBrewTaps(ctx)
+	}
+	return PrintSources(w, rp.Format, packageTool, sources)
+}
+
 // determine package tool and args on this system
-func (rp RequirementsParser) Parse() (sudo, packageTool, autoYes, reqs string) {
-	sudo, packageTool, autoYes = rp.parseTooling()
+func (rp RequirementsParser) Parse(ctx context.Context) (sudo, packageTool, autoYes, reqs string) {
+	sudo, packageTool, autoYes, found := rp.Plan(ctx)
+	reqs = RequirementsList(found)
+	return sudo, packageTool, autoYes, reqs
+}
+
+// determine package tool and args on this system and the system
+// requirements to install with it
+func (rp RequirementsParser) Plan(ctx context.Context) (sudo, packageTool, autoYes string, found []Requirement) {
+	sudo, packageTool, autoYes = rp.parseTooling(ctx)
 	// output sources for apt, taps for brew
 	if rp.Sources {
-		switch packageTool {
-		case "apt":
-			fmt.Print(GetAptSources())
-		case "brew":
-			fmt.Print(GetBrewTaps())
-		}
+		FatalCheck(rp.WriteSources(ctx, os.Stdout, packageTool))
+		os.Exit(0)
+	}
+
+	if rp.UseStdout && rp.Dir == "" && rp.File == "" && !rp.UseStdin {
+		// output requirements to stdout
+		FatalCheck(PrintRequirements(os.Stdout, rp.Format, rp.InstalledRequirements(ctx, packageTool)))
 		os.Exit(0)
 	}
+	found = rp.SystemRequirements(packageTool)
+	return sudo, packageTool, autoYes, found
+}
 
+// the system requirements for packageTool from the requested directories,
+// file or stdin, or the current directory
+func (rp RequirementsParser) SystemRequirements(packageTool string) (found []Requirement) {
+	// fakepm installs what the tool it emulates would
+	if tool := emulatedTool(packageTool); tool != packageTool {
+		found = rp.SystemRequirements(tool)
+		for i := range found {
+			found[i].Tool = packageTool
+		}
+		return found
+	}
 	if rp.Dir != "" {
 		// search directory for requirements
-		if strings.Contains(rp.Dir, ",") {
-			reqs = getSysRequirementsMultipleDirs(strings.Split(rp.Dir, ","), packageTool, rp.Recurse)
-		} else {
-			reqs = getSysRequirements(rp.Dir, packageTool, rp.Recurse)
+		for _, dirPath := range strings.Split(rp.Dir, ",") {
+			found = append(found, findSysRequirements(dirPath, packageTool, rp.Recurse)...)
 		}
 	} else if rp.File != "" {
 		// read specified file for requirements
-		b, err := ioutil.ReadFile(rp.File)
-		FatalCheck(err)
-		reqs = string(b)
+		b := readRequirementsFile(rp.File)
+		found = rp.parseInput(b, rp.File, packageTool)
 	} else if rp.UseStdin {
 		// read stdin for requirements
-		reader := bufio.NewReader(os.Stdin)
-		reqs, _ = reader.ReadString('\n')
-	} else if rp.UseStdout {
-		// output requirements to stdout
-		reqs = rp.ListInstalled(packageTool)
-		fmt.Print(reqs)
-		os.Exit(0)
+		b := readRequirementsStdin()
+		found = rp.parseInput(b, "stdin", packageTool)
 	} else {
 		// parse the current directory
-		reqs = getSysRequirements(".", packageTool, rp.Recurse)
+		found = findSysRequirements(".", packageTool, rp.Recurse)
 	}
-	reqs = strings.TrimSpace(strings.Replace(reqs, "\n", " ", -1))
-	return sudo, packageTool, autoYes, reqs
+	return found
 }
 
-func (rp RequirementsParser) ParsePip() (reqs string) {
-	if rp.Dir != "" {
-		// search directory for requirements
-		if strings.Contains(rp.Dir, ",") {
-			reqs = GetPipRequirementsMultipleDirs(strings.Split(rp.Dir, ","), rp.Recurse)
-		} else {
-			reqs = GetPipRequirements(rp.Dir, rp.Recurse)
+// parse a reqs.yml document or a plain requirements list belonging to
+// the InputTool section
+func (rp RequirementsParser) parseInput(b []byte, source, packageTool string) (found []Requirement) {
+	if isReqsYml(string(b)) {
+		found = parseYmlRequirements(b, source, packageTool, "common", packageTool)
+		for _, rf := range includedFiles(b, source) {
+			found = append(found, sysRequirementsIn(rf, packageTool)...)
 		}
-	} else if rp.File != "" {
-		// read specified file for requirements
-		b, err := ioutil.ReadFile(rp.File)
-		FatalCheck(err)
-		reqs = string(b)
-	} else {
-		// parse the current directory
-		reqs = GetPipRequirements(".", rp.Recurse)
+		return found
 	}
-	return reqs
+	section := rp.InputTool
+	if section == "" {
+		section = packageTool
+	}
+	if section != packageTool && section != "common" {
+		log.Warn("Skipping " + section + " requirements from " + source + " on a " + packageTool + " system")
+		return nil
+	}
+	for _, r := range parseRequirementsText(string(b), packageTool, source) {
+		r.Section = section
+		found = append(found, r)
+	}
+	return found
+}
+
+func (rp RequirementsParser) ParsePip() (reqs string) {
+	return RequirementLines(rp.ToolRequirements("pip"))
 }
 
 func (rp RequirementsParser) ParsePip3() (reqs string) {
+	return RequirementLines(rp.ToolRequirements("pip3"))
+}
+
+func (rp RequirementsParser) ParseNpm() (reqs string) {
+	return RequirementsList(rp.ToolRequirements("npm"))
+}
+
+// the pip, pip3 or npm requirements, tool naming the reqs.yml section
+// too, with the files and lines they are on
+func (rp RequirementsParser) ToolRequirements(tool string) (found []Requirement) {
+	find := func(dirPath string) []Requirement {
+		if tool == "npm" {
+			return findNpmRequirements(dirPath, rp.Recurse)
+		}
+		return findPipRequirements(dirPath, tool, rp.Recurse)
+	}
 	if rp.Dir != "" {
 		// search directory for requirements
-		if strings.Contains(rp.Dir, ",") {
-			reqs = GetPip3RequirementsMultipleDirs(strings.Split(rp.Dir, ","), rp.Recurse)
-		} else {
-			reqs = GetPip3Requirements(rp.Dir, rp.Recurse)
+		for _, dirPath := range strings.Split(rp.Dir, ",") {
+			found = append(found, find(dirPath)...)
 		}
 	} else if rp.File != "" {
 		// read specified file for requirements
-		b, err := ioutil.ReadFile(rp.File)
-		FatalCheck(err)
-		reqs = string(b)
+		found = rp.fileRequirements(tool)
 	} else {
 		// parse the current directory
-		reqs = GetPip3Requirements(".", rp.Recurse)
+		found = find(".")
 	}
-	return reqs
+	return found
 }
 
-func (rp RequirementsParser) ParseNpm() (reqs string) {
-	if rp.Dir != "" {
-		// search directory for requirements
-		if strings.Contains(rp.Dir, ",") {
-			reqs = GetNpmRequirementsMultipleDirs(strings.Split(rp.Dir, ","), rp.Recurse)
+// the requirements in rp.File, only the given section when it is a
+// reqs.yml
+func (rp RequirementsParser) fileRequirements(section string) (found []Requirement) {
+	b := readRequirementsFile(rp.File)
+	if !isReqsYml(string(b)) {
+		return parseRequirementsText(string(b), section, rp.File)
+	}
+	found = parseYmlRequirements(b, rp.File, section, section)
+	for _, rf := range includedFiles(b, rp.File) {
+		if section == "npm" {
+			found = append(found, npmRequirementsIn(rf)...)
 		} else {
-			reqs = GetNpmRequirements(rp.Dir, rp.Recurse)
+			found = append(found, pipRequirementsIn(rf, section)...)
 		}
-	} else if rp.File != "" {
-		// read specified file for requirements
-		b, err := ioutil.ReadFile(rp.File)
-		FatalCheck(err)
-		reqs = string(b)
-	} else {
-		// parse the current directory
-		reqs = GetNpmRequirements(".", rp.Recurse)
 	}
-	return reqs
+	return found
+}
+
+// the non-empty sections of the reqs.yml files in the requested
+// directories or file, used to enable the pip, pip3 and npm steps
+func (rp RequirementsParser) YmlSections() map[string]bool {
+	sections := make(map[string]bool)
+	var ymlPaths []string
+	if rp.File != "" {
+		b := readRequirementsFile(rp.File)
+		if isReqsYml(string(b)) {
+			ymlPaths = append(ymlPaths, rp.File)
+			for _, rf := range includedFiles(b, rp.File) {
+				if rf.Kind == KindReqsYml {
+					ymlPaths = append(ymlPaths, rf.Path)
+				}
+			}
+		}
+	} else if !rp.UseStdin {
+		dirArg := "."
+		if rp.Dir != "" {
+			dirArg = rp.Dir
+		}
+		for _, dirPath := range strings.Split(dirArg, ",") {
+			for _, rf := range findRequirementsFiles(dirPath, rp.Recurse) {
+				if rf.Kind == KindReqsYml {
+					ymlPaths = append(ymlPaths, rf.Path)
+				}
+			}
+		}
+	}
+	for _, ymlPath := range ymlPaths {
+		for section, packages := range ymlToMap(ymlPath) {
+			if len(packages) > 0 {
+				sections[section] = true
+			}
+		}
+	}
+	return sections
+}
+
+// build a Brewfile from the reqs.yml files in the requested directories
+func (rp RequirementsParser) ExportBrewfile() string {
+	dirArg := "."
+	if rp.Dir != "" {
+		dirArg = rp.Dir
+	}
+	return GetBrewfileMultipleDirs(strings.Split(dirArg, ","), rp.Recurse)
+}
+
+// lint the requirements files in the requested directories or file
+func (rp RequirementsParser) Lint() (diags []Diagnostic) {
+	if rp.File != "" {
+		return LintFile(rp.File)
+	}
+	dirArg := "."
+	if rp.Dir != "" {
+		dirArg = rp.Dir
+	}
+	for _, dirPath := range strings.Split(dirArg, ",") {
+		diags = append(diags, LintDir(dirPath, rp.Recurse)...)
+	}
+	return diags
 }
 
 // TODO: check the exist reqs.yml in current directory if one exists
 // and merge the results together, removing duplicate entries
 // check the currently installed packages for system and/or pip deps
 // and return the string for a reqs.yml
-func (rp RequirementsParser) GenerateReqsYml() map[string][]string {
+func (rp RequirementsParser) GenerateReqsYml(ctx context.Context) map[string][]string {
 	yml := make(map[string][]string)
-	_, packageTool, _ := rp.parseTooling()
-	installed := ""
-	if packageTool == "apt" {
-		installed = AptListInstalled(rp.WithVersion)
-	} else if packageTool == "brew" {
-		installed = BrewListInstalled()
-	} else if packageTool == "dnf" {
-		installed = DnfListInstalled(rp.WithVersion)
-	}
-
-	yml[packageTool] = strings.Split(installed, " ")
+	_, packageTool, _ := rp.parseTooling(ctx)
+	installed := rp.ListInstalled(ctx, packageTool)
+	yml[emulatedTool(packageTool)] = strings.Split(installed, " ")
 	return yml
 }
 
+// the currently installed system packages as requirements
+func (rp RequirementsParser) GenerateRequirements(ctx context.Context) []Requirement {
+	_, packageTool, _ := rp.parseTooling(ctx)
+	return rp.InstalledRequirements(ctx, packageTool)
+}
+
 func StdoutReqsYml(yml map[string][]string) {
 	for tool, packages := range yml {
 		fmt.Println(tool + ":")
@@ -0,0 +1,123 @@
+package reqs
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "reqs-test")
+	assert.Nil(t, err)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestFindSysRequirements(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml":             "common:\n  - git\napt:\n  - python python-pip\ndnf:\n  - golang\n",
+		"apt-requirements.txt": "# comment\ncurl=7.58.0\ngit\n",
+	})
+	defer os.RemoveAll(dir)
+
+	found := findSysRequirements(dir, "apt", false)
+	assert.Equal(t, "curl=7.58.0 git python python-pip", RequirementsList(found))
+
+	yml := filepath.Join(dir, "reqs.yml")
+	assert.Equal(t, Requirement{Name: "python-pip", Tool: "apt", Section: "apt", Source: yml, Line: 4, spec: "python-pip"}, found[len(found)-1])
+	assert.Equal(t, "7.58.0", found[0].Version)
+	assert.Equal(t, 2, found[0].Line)
+}
+
+func TestRequirementLinesPipPaths(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("project", "api"))
+	assert.Nil(t, err)
+	found := parseRequirementsText("-r base.txt\n-e .[dev]\n-i https://pypi.example.com/simple\n./vendor/pkg; python_version > '3'\nflask==1.0.2 \\\n    --hash=sha256:abc\n", "pip", filepath.Join("project", "api", "requirements.txt"))
+	assert.Equal(t, 5, len(found))
+	assert.Equal(t, 5, found[4].Line)
+	assert.Equal(t, "-r "+filepath.Join(dir, "base.txt")+"\n"+
+		"-e "+dir+"[dev]\n"+
+		"-i https://pypi.example.com/simple\n"+
+		filepath.Join(dir, "vendor", "pkg")+"; python_version > '3'\n"+
+		"flask==1.0.2 --hash=sha256:abc", RequirementLines(found))
+}
+
+func TestSplitVersion(t *testing.T) {
+	for _, c := range [][4]string{
+		{"curl=7.58.0", "apt", "curl", "7.58.0"},
+		{"flask==1.0", "pip", "flask", "1.0"},
+		{"flask>=1.0", "pip3", "flask", ">=1.0"},
+		{"@angular/cli@6.0.0", "npm", "@angular/cli", "6.0.0"},
+		{"@angular/cli", "npm", "@angular/cli", ""},
+		{"go", "brew", "go", ""},
+	} {
+		name, version := splitVersion(c[0], c[1])
+		assert.Equal(t, c[2], name)
+		assert.Equal(t, c[3], version)
+	}
+}
+
+func TestPrintRequirementsJSON(t *testing.T) {
+	var out bytes.Buffer
+	found := WithStatus([]Requirement{NewRequirement("curl=7.58.0", "apt")}, StatusPlanned)
+	assert.Nil(t, PrintRequirements(&out, FormatJSON, found))
+	assert.JSONEq(t, `[{"package": "curl", "version": "7.58.0", "tool": "apt", "status": "planned"}]`, out.String())
+
+	out.Reset()
+	assert.Nil(t, PrintRequirements(&out, FormatJSON, nil))
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestParseInput(t *testing.T) {
+	rp := RequirementsParser{}
+	plain := "# system deps\ngit\ncurl wget\n"
+	assert.Equal(t, "git curl wget", RequirementsList(rp.parseInput([]byte(plain), "stdin", "apt")))
+
+	yml := "# reqs\ncommon:\n  - git\napt:\n  - golang-go\ndnf:\n  - golang\n"
+	assert.Equal(t, "git golang-go", RequirementsList(rp.parseInput([]byte(yml), "stdin", "apt")))
+
+	rp.InputTool = "dnf"
+	assert.Empty(t, rp.parseInput([]byte(plain), "stdin", "apt"))
+	rp.InputTool = "common"
+	found := rp.parseInput([]byte(plain), "stdin", "apt")
+	assert.Equal(t, 3, len(found))
+	assert.Equal(t, "common", found[0].Section)
+	assert.Equal(t, 2, found[0].Line)
+}
+
+func TestParseYmlOptionalAndAnyOf(t *testing.T) {
+	yml := "apt:\n  - git\n  - optional: htop\n  - any-of: [fd-find, fd]\n"
+	found := parseYmlRequirements([]byte(yml), "reqs.yml", "apt", "apt")
+	assert.Equal(t, 3, len(found))
+	assert.False(t, found[0].Optional)
+	assert.True(t, found[1].Optional)
+	assert.Equal(t, "htop", found[1].Name)
+	assert.Equal(t, 3, found[1].Line)
+	assert.Equal(t, "fd-find", found[2].Name)
+	assert.Equal(t, []string{"fd-find", "fd"}, found[2].Alternatives)
+	assert.Equal(t, 4, found[2].Line)
+}
+
+func TestResolve(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Results["apt-cache show -q htop"] = FakeResult{ExitCode: 100}
+	fake.Results["apt-cache show -q fd-find"] = FakeResult{ExitCode: 100}
+	fake.Results["apt-cache show -q bat"] = FakeResult{ExitCode: 100}
+	fake.Results["apt-cache show -q batcat"] = FakeResult{ExitCode: 100}
+	yml := "apt:\n  - git\n  - optional: htop\n  - optional: ripgrep\n  - any-of: [fd-find, fd]\n  - any-of: [bat, batcat]\n"
+	pc := PackageConfig{Tool: "apt"}
+	resolved, unresolved := pc.Resolve(context.Background(), parseYmlRequirements([]byte(yml), "reqs.yml", "apt", "apt"))
+	assert.Equal(t, "git ripgrep fd", RequirementsList(resolved))
+	assert.Equal(t, 2, len(unresolved))
+	assert.Equal(t, StatusSkipped, unresolved[0].Status)
+	assert.Equal(t, StatusFailed, unresolved[1].Status)
+	assert.Equal(t, "apt has none of bat, batcat", unresolved[1].Error)
+}
@@ -0,0 +1,176 @@
+package reqs
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// undoing a transaction from the history, packages it installed are
+// removed and ones it upgraded go back to their earlier version where
+// the tool can install a given version
+
+// the verb removing packages with each system tool
+var removeVerbs = map[string]string{
+	"apt":    "remove",
+	"dnf":    "remove",
+	"yum":    "remove",
+	"brew":   "uninstall",
+	FakeTool: "remove",
+}
+
+// undo tx with pc.Tool for its system packages, the changes that can't be
+// undone are returned
+func (pc PackageConfig) Rollback(ctx context.Context, tx Transaction) (skipped []PackageChange, err error) {
+	groups := make(map[string][]PackageChange)
+	for _, c := range tx.Changes {
+		if c.Removed {
+			// reqs doesn't remove packages, something else did
+			skipped = append(skipped, c)
+			continue
+		}
+		spec := c.Name
+		if !c.Installed {
+			spec = versionSpec(c.Tool, c.Name, c.Before)
+		}
+		if err := ValidatePackageName(c.Tool, spec); err != nil {
+			log.Warn(err)
+			skipped = append(skipped, c)
+			continue
+		}
+		groups[c.Tool] = append(groups[c.Tool], c)
+	}
+	// language packages first, they may come from system packages
+	var tools []string
+	for tool := range groups {
+		if tool != tx.Tool {
+			tools = append(tools, tool)
+		}
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		cmds, notUndone := undoLanguage(tool, groups[tool])
+		skipped = append(skipped, notUndone...)
+		for _, argv := range cmds {
+			log.Info(strings.Join(argv, " "))
+			if _, err := streamCommand(ctx, tool, pc.Quiet, Command{Argv: argv}); err != nil {
+				return skipped, err
+			}
+		}
+	}
+	if len(groups[tx.Tool]) == 0 && len(tx.ToolHistory) == 0 {
+		return skipped, nil
+	}
+	if tx.Tool != pc.Tool {
+		log.Warn("Transaction " + strconv.Itoa(tx.ID) + " installed with " + tx.Tool + ", not " + pc.Tool)
+		return append(skipped, groups[tx.Tool]...), nil
+	}
+	cmds, notUndone := pc.undoSystem(tx, groups[tx.Tool])
+	skipped = append(skipped, notUndone...)
+	for _, argv := range cmds {
+		log.Info(strings.Join(argv, " "))
+		if err := pc.runLocked(ctx, Command{Argv: argv}); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
+
+// name at version in tool's syntax
+func versionSpec(tool, name, version string) string {
+	switch tool {
+	case "pip", "pip3":
+		return name + "==" + version
+	case "npm":
+		return name + "@" + version
+	}
+	return name + "=" + version
+}
+
+// dnf and yum undo their own transactions, other tools remove and
+// install packages
+func (pc PackageConfig) undoSystem(tx Transaction, changes []PackageChange) (cmds [][]string, skipped []PackageChange) {
+	if (pc.Tool == "dnf" || pc.Tool == "yum") && len(tx.ToolHistory) > 0 {
+		for i := len(tx.ToolHistory) - 1; i >= 0; i-- {
+			argv := append(pc.toolArgv(), "history", "undo")
+			argv = append(argv, strings.Fields(pc.AutoYes)...)
+			cmds = append(cmds, append(argv, strconv.Itoa(tx.ToolHistory[i])))
+		}
+		return cmds, nil
+	}
+	var remove, downgrade []string
+	for _, c := range changes {
+		switch {
+		case c.Installed:
+			remove = append(remove, c.Name)
+		case c.Before == "" || pc.Tool == "brew" || pc.Tool == "dnf" || pc.Tool == "yum":
+			// brew installs no older versions and dnf needs its history
+			skipped = append(skipped, c)
+		default:
+			downgrade = append(downgrade, versionSpec(pc.Tool, c.Name, c.Before))
+		}
+	}
+	autoYes := strings.Fields(pc.AutoYes)
+	if pc.Tool == "brew" {
+		autoYes = nil
+	}
+	if len(remove) > 0 {
+		argv := append(pc.toolArgv(), removeVerbs[pc.Tool])
+		cmds = append(cmds, append(append(argv, autoYes...), remove...))
+	}
+	if len(downgrade) > 0 {
+		argv := append(append(pc.toolArgv(), "install"), autoYes...)
+		if pc.Tool == "apt" {
+			argv = append(argv, "--allow-downgrades")
+		}
+		cmds = append(cmds, append(argv, downgrade...))
+	}
+	return cmds, skipped
+}
+
+// pip, pip3 and npm uninstall what tx installed and install the earlier
+// version of what it upgraded
+func undoLanguage(tool string, changes []PackageChange) (cmds [][]string, skipped []PackageChange) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	command := changes[0].Command
+	if command == "" {
+		command = tool
+	}
+	argv := func(args ...string) []string {
+		if changes[0].Sudo {
+			return append([]string{"sudo", command}, args...)
+		}
+		return append([]string{command}, args...)
+	}
+	var remove, downgrade []string
+	for _, c := range changes {
+		switch {
+		case c.Installed:
+			remove = append(remove, c.Name)
+		case c.Before == "":
+			skipped = append(skipped, c)
+		default:
+			downgrade = append(downgrade, versionSpec(tool, c.Name, c.Before))
+		}
+	}
+	if tool == "npm" {
+		if len(remove) > 0 {
+			cmds = append(cmds, append(argv("uninstall", "-g"), remove...))
+		}
+		if len(downgrade) > 0 {
+			cmds = append(cmds, append(argv("install", "-g"), downgrade...))
+		}
+		return cmds, skipped
+	}
+	if len(remove) > 0 {
+		cmds = append(cmds, append(argv("uninstall", "-y"), remove...))
+	}
+	if len(downgrade) > 0 {
+		cmds = append(cmds, append(argv("install"), downgrade...))
+	}
+	return cmds, skipped
+}
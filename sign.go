@@ -0,0 +1,334 @@
+package reqs
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requirements files can be signed with ed25519 so installs can refuse
+// ones that weren't.  Public keys and signatures are in the minisign
+// format, a file signed by reqs sign verifies with minisign -V and a
+// legacy signature made with minisign -S -l verifies with reqs
+
+// signatures are detached, next to the file with this suffix
+const SignatureSuffix = ".minisig"
+
+// minisign's algorithm ids, Ed signs the file itself and ED a blake2b
+// hash of it
+var (
+	sigAlgorithm       = []byte("Ed")
+	hashedSigAlgorithm = []byte("ED")
+)
+
+type PublicKey struct {
+	// the id signatures name their key with
+	ID  uint64
+	Key ed25519.PublicKey
+}
+
+func (k PublicKey) IDString() string {
+	return fmt.Sprintf("%016X", k.ID)
+}
+
+type SecretKey struct {
+	ID  uint64
+	Key ed25519.PrivateKey
+}
+
+func (k SecretKey) Public() PublicKey {
+	return PublicKey{ID: k.ID, Key: k.Key.Public().(ed25519.PublicKey)}
+}
+
+// where reqs sign keeps its key, $XDG_CONFIG_HOME/reqs/reqs.key, by
+// default in ~/.config
+var DefaultSecretKeyPath = defaultSecretKeyPath()
+
+func defaultSecretKeyPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "reqs", "reqs.key")
+}
+
+// a new key pair with a random id
+func GenerateKey() (SecretKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SecretKey{}, err
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return SecretKey{}, err
+	}
+	return SecretKey{ID: binary.LittleEndian.Uint64(id[:]), Key: key}, nil
+}
+
+// a comment line and a base64 line, the way minisign writes keys
+func encodeKey(comment string, id uint64, key []byte) []byte {
+	b := append([]byte{}, sigAlgorithm...)
+	b = binary.LittleEndian.AppendUint64(b, id)
+	b = append(b, key...)
+	return []byte("untrusted comment: " + comment + "\n" + base64.StdEncoding.EncodeToString(b) + "\n")
+}
+
+func decodeKey(text []byte, size int) (id uint64, key []byte, err error) {
+	lines := strings.Split(strings.TrimSpace(string(text)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "untrusted comment:") {
+		return 0, nil, errors.New("not a minisign key")
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(b) != 2+8+size || !bytes.Equal(b[:2], sigAlgorithm) {
+		return 0, nil, errors.New("not an ed25519 minisign key")
+	}
+	return binary.LittleEndian.Uint64(b[2:10]), b[10:], nil
+}
+
+func (k PublicKey) Encode() []byte {
+	return encodeKey("minisign public key "+k.IDString(), k.ID, k.Key)
+}
+
+// the secret key is kept unencrypted, unlike minisign's
+func (k SecretKey) Encode() []byte {
+	return encodeKey("reqs secret key "+k.Public().IDString(), k.ID, k.Key)
+}
+
+func ParsePublicKey(text []byte) (PublicKey, error) {
+	id, key, err := decodeKey(text, ed25519.PublicKeySize)
+	return PublicKey{ID: id, Key: key}, err
+}
+
+func ParseSecretKey(text []byte) (SecretKey, error) {
+	id, key, err := decodeKey(text, ed25519.PrivateKeySize)
+	return SecretKey{ID: id, Key: key}, err
+}
+
+// the secret key at path, generated along with a .pub public key next
+// to it when there is none yet
+func LoadOrGenerateKey(path string) (key SecretKey, generated bool, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		key, err = ParseSecretKey(b)
+		if err != nil {
+			return key, false, errors.New(path + ": " + err.Error())
+		}
+		return key, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return key, false, err
+	}
+	if key, err = GenerateKey(); err != nil {
+		return key, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return key, false, err
+	}
+	if err := ioutil.WriteFile(path, key.Encode(), 0600); err != nil {
+		return key, false, err
+	}
+	return key, true, ioutil.WriteFile(PublicKeyPath(path), key.Public().Encode(), 0644)
+}
+
+// the public key written next to a secret key
+func PublicKeyPath(secretKeyPath string) string {
+	return strings.TrimSuffix(secretKeyPath, filepath.Ext(secretKeyPath)) + ".pub"
+}
+
+// a minisign signature of b, the trusted comment records the file's path
+// relative to the signed directory so a signature doesn't verify another
+// signed file put in its place, there or in another directory
+func (k SecretKey) Sign(b []byte, name string) []byte {
+	return k.signWithComment(b, "timestamp:"+strconv.FormatInt(time.Now().Unix(), 10)+"\tfile:"+name)
+}
+
+func (k SecretKey) signWithComment(b []byte, trusted string) []byte {
+	sig := append([]byte{}, sigAlgorithm...)
+	sig = binary.LittleEndian.AppendUint64(sig, k.ID)
+	sig = append(sig, ed25519.Sign(k.Key, b)...)
+	global := ed25519.Sign(k.Key, append(append([]byte{}, sig[10:]...), trusted...))
+	return []byte("untrusted comment: signature from reqs secret key\n" +
+		base64.StdEncoding.EncodeToString(sig) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+// write the signature of the file at path next to it, for installs of
+// the directory root
+func SignFile(key SecretKey, root, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+SignatureSuffix, key.Sign(b, signedName(root, path)), 0644)
+}
+
+// the name a signature records for path, its slash separated path
+// relative to root
+func signedName(root, path string) string {
+	rel, err := filepath.Rel(absPath(root), absPath(path))
+	if err != nil {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// the *.pub public keys in dir
+func LoadTrustedKeys(dir string) (keys []PublicKey, err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePublicKey(b)
+		if err != nil {
+			return nil, errors.New(path + ": " + err.Error())
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no trusted keys, *.pub files, in " + dir)
+	}
+	return keys, nil
+}
+
+// a requirements file without a signature by a trusted key
+type SignatureError struct {
+	Path, Reason string
+}
+
+func (e *SignatureError) Error() string {
+	return e.Path + " is not used, " + e.Reason
+}
+
+// check the detached signature of b, named name, against keys
+func verify(b []byte, name string, signature []byte, keys []PublicKey) error {
+	lines := strings.Split(strings.TrimSpace(string(signature)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("its signature is not a minisign signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("its signature is not a minisign signature")
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return errors.New("its signature is not a minisign signature")
+	}
+	if bytes.Equal(sig[:2], hashedSigAlgorithm) {
+		return errors.New("prehashed signatures aren't supported, sign with reqs sign or minisign -S -l")
+	}
+	if !bytes.Equal(sig[:2], sigAlgorithm) {
+		return errors.New("its signature is not an ed25519 signature")
+	}
+	id := binary.LittleEndian.Uint64(sig[2:10])
+	for _, key := range keys {
+		if key.ID != id {
+			continue
+		}
+		trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+		if !ed25519.Verify(key.Key, b, sig[10:]) || !ed25519.Verify(key.Key, append(append([]byte{}, sig[10:]...), trusted...), global) {
+			return errors.New("its signature does not verify with key " + key.IDString())
+		}
+		// a signature that doesn't name its file could be moved to any
+		// other path
+		for _, field := range strings.Split(trusted, "\t") {
+			if signed := strings.TrimPrefix(field, "file:"); signed != field {
+				if signed != name {
+					return errors.New("its signature is for " + signed)
+				}
+				return nil
+			}
+		}
+		return errors.New("its signature doesn't name the file it was made for, sign it with reqs sign")
+	}
+	return errors.New("it is signed by untrusted key " + PublicKey{ID: id}.IDString())
+}
+
+// check the signature next to each file, made for its path relative to
+// root, files fetched for remote includes are trusted by the pins of the
+// files that include them.  What was verified is kept for readFile, so a
+// file changed on disk after its check is never parsed
+func (d *Discovery) Verify(root string, files []RequirementsFile) error {
+	if !d.RequireSigned {
+		return nil
+	}
+	for _, rf := range files {
+		if _, ok := d.verified[absPath(rf.Path)]; ok || d.cached(rf.Path) {
+			continue
+		}
+		b, err := ioutil.ReadFile(rf.Path)
+		if err != nil {
+			return err
+		}
+		signature, err := ioutil.ReadFile(rf.Path + SignatureSuffix)
+		if os.IsNotExist(err) {
+			return &SignatureError{Path: rf.Path, Reason: "it has no signature " + filepath.Base(rf.Path) + SignatureSuffix}
+		}
+		if err != nil {
+			return err
+		}
+		if err := verify(b, signedName(root, rf.Path), signature, d.TrustedKeys); err != nil {
+			return &SignatureError{Path: rf.Path, Reason: err.Error()}
+		}
+		if d.verified == nil {
+			d.verified = make(map[string][]byte)
+		}
+		d.verified[absPath(rf.Path)] = b
+		d.report("Verified the signature of " + rf.Path)
+	}
+	return nil
+}
+
+// the contents of a requirements file, as Verify checked them when
+// signatures are required
+func (d *Discovery) readFile(path string) ([]byte, error) {
+	if !d.RequireSigned || d.cached(path) {
+		return ioutil.ReadFile(path)
+	}
+	if b, ok := d.verified[absPath(path)]; ok {
+		return b, nil
+	}
+	return nil, &SignatureError{Path: path, Reason: "its signature wasn't checked"}
+}
+
+// whether path is a remote include in the cache
+func (d *Discovery) cached(path string) bool {
+	return strings.HasPrefix(absPath(path), absPath(d.cacheDir())+string(filepath.Separator))
+}
+
+// the requirements files in dirPath, the local files they include and
+// the package.json files npm installs from, the files reqs sign signs
+func (d *Discovery) FilesToSign(dirPath string, recurse bool) (paths []string, err error) {
+	files, err := d.Find(dirPath, recurse)
+	if err != nil {
+		return nil, err
+	}
+	if files, err = d.Expand(dirPath, files); err != nil {
+		return nil, err
+	}
+	for _, rf := range files {
+		if !d.cached(rf.Path) {
+			paths = append(paths, rf.Path)
+		}
+	}
+	packageJSONs, err := d.findPackageJSON(dirPath, recurse)
+	return append(paths, packageJSONs...), err
+}
@@ -0,0 +1,111 @@
+package reqs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml":             "common:\n  - git\n",
+		"apt-requirements.txt": "curl\n",
+		"keys/.keep":           "",
+	})
+	defer os.RemoveAll(dir)
+	key, generated, err := LoadOrGenerateKey(filepath.Join(dir, "reqs.key"))
+	assert.Nil(t, err)
+	assert.True(t, generated)
+	again, generated, err := LoadOrGenerateKey(filepath.Join(dir, "reqs.key"))
+	assert.Nil(t, err)
+	assert.False(t, generated)
+	assert.Equal(t, key, again)
+
+	pub, err := ioutil.ReadFile(filepath.Join(dir, "reqs.pub"))
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "keys", "reqs.pub"), pub, 0644))
+	keys, err := LoadTrustedKeys(filepath.Join(dir, "keys"))
+	assert.Nil(t, err)
+	assert.Equal(t, []PublicKey{key.Public()}, keys)
+
+	yml := RequirementsFile{Path: filepath.Join(dir, "reqs.yml"), Kind: KindReqsYml}
+	apt := RequirementsFile{Path: filepath.Join(dir, "apt-requirements.txt"), Kind: KindToolRequirements, Tool: "apt"}
+	d := &Discovery{RequireSigned: true, TrustedKeys: keys, CacheDir: filepath.Join(dir, "cache")}
+	assert.EqualError(t, d.Verify(dir, []RequirementsFile{yml}), yml.Path+" is not used, it has no signature reqs.yml.minisig")
+
+	assert.Nil(t, SignFile(key, dir, yml.Path))
+	assert.Nil(t, SignFile(key, dir, apt.Path))
+	assert.Nil(t, d.Verify(dir, []RequirementsFile{yml, apt}))
+
+	// parsed as verified even when changed since
+	assert.Nil(t, ioutil.WriteFile(apt.Path, []byte("curl\nnetcat\n"), 0644))
+	b, err := d.readFile(apt.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, "curl\n", string(b))
+	_, err = d.readFile(filepath.Join(dir, "unchecked-requirements.txt"))
+	assert.IsType(t, &SignatureError{}, err)
+	assert.Nil(t, ioutil.WriteFile(apt.Path, []byte("curl\n"), 0644))
+	d.verified = nil
+
+	// a signed file replayed in another directory
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	replayed := RequirementsFile{Path: filepath.Join(dir, "sub", "reqs.yml"), Kind: KindReqsYml}
+	for _, name := range []string{"reqs.yml", "reqs.yml" + SignatureSuffix} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "sub", name), b, 0644))
+	}
+	assert.EqualError(t, d.Verify(dir, []RequirementsFile{replayed}), replayed.Path+" is not used, its signature is for reqs.yml")
+	assert.Nil(t, SignFile(key, dir, replayed.Path))
+	assert.Nil(t, d.Verify(dir, []RequirementsFile{replayed}))
+
+	// a signed file swapped for another signed file
+	sig, err := ioutil.ReadFile(apt.Path + SignatureSuffix)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(yml.Path+SignatureSuffix, sig, 0644))
+	apt.Path, yml.Path = yml.Path, apt.Path
+	assert.Nil(t, os.Rename(apt.Path, filepath.Join(dir, "tmp")))
+	assert.Nil(t, os.Rename(yml.Path, apt.Path))
+	assert.Nil(t, os.Rename(filepath.Join(dir, "tmp"), yml.Path))
+	assert.EqualError(t, d.Verify(dir, []RequirementsFile{apt}), apt.Path+" is not used, its signature is for apt-requirements.txt")
+
+	other, err := GenerateKey()
+	assert.Nil(t, err)
+	d.TrustedKeys = []PublicKey{other.Public()}
+	assert.EqualError(t, d.Verify(dir, []RequirementsFile{yml}), yml.Path+" is not used, it is signed by untrusted key "+key.Public().IDString())
+
+	_, err = LoadTrustedKeys(dir + "/missing")
+	assert.NotNil(t, err)
+}
+
+func TestVerifyNamesFile(t *testing.T) {
+	key, err := GenerateKey()
+	assert.Nil(t, err)
+	keys := []PublicKey{key.Public()}
+	b := []byte("common:\n  - git\n")
+
+	assert.Nil(t, verify(b, "reqs.yml", key.Sign(b, "reqs.yml"), keys))
+	assert.EqualError(t, verify(b, "sub/reqs.yml", key.Sign(b, "reqs.yml"), keys), "its signature is for reqs.yml")
+	// minisign's own trusted comment names no file, so could be for any
+	assert.EqualError(t, verify(b, "reqs.yml", key.signWithComment(b, "timestamp:1555555555"), keys), "its signature doesn't name the file it was made for, sign it with reqs sign")
+}
+
+func TestFilesToSign(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"reqs.yml":                    "include:\n  - shared/apt-requirements.txt\n",
+		"shared/apt-requirements.txt": "curl\n",
+		"web/package.json":            "{}\n",
+	})
+	defer os.RemoveAll(dir)
+	d := &Discovery{MaxDepth: -1}
+	paths, err := d.FilesToSign(dir, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "reqs.yml"),
+		filepath.Join(dir, "shared", "apt-requirements.txt"),
+		filepath.Join(dir, "web", "package.json"),
+	}, paths)
+	assert.Equal(t, "shared/apt-requirements.txt", signedName(dir, paths[1]))
+}
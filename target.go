@@ -0,0 +1,252 @@
+package reqs
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// targets are the systems integration tests run reqs on, a temporary
+// directory with fakepm standing in for the package tools, a podman or
+// docker container, or a vagrant machine
+
+type Target interface {
+	Up() error
+	// run reqs with args on the target
+	Reqs(args ...string) error
+	Down() error
+}
+
+// how to bring up a target, read from test-targets.yml
+type TargetConfig struct {
+	// container image for container targets
+	Image string `yaml:"image"`
+	// machine in the Vagrantfile for vagrant targets
+	Vagrant string `yaml:"vagrant"`
+	// package tool of the target, what fakepm emulates on local targets
+	Tool string `yaml:"tool"`
+	// commands run once a container is up, e.g. to install sudo
+	Setup [][]string `yaml:"setup"`
+}
+
+func LoadTargetConfigs(path string) (configs map[string]TargetConfig, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.UnmarshalStrict(b, &configs)
+	return configs, err
+}
+
+func runnerOrDefault(r Runner) Runner {
+	if r == nil {
+		return DefaultRunner
+	}
+	return r
+}
+
+// runs reqs in a temporary directory holding copies of Sources, with
+// links to fakepm for the package tool, pip, pip3, npm and sudo sharing
+// one state file, so nothing outside the directory is installed to or
+// needs root
+type LocalTarget struct {
+	Config TargetConfig
+	// directory holding the reqs and fakepm binaries
+	BinDir  string
+	Sources []string
+	Runner  Runner
+	dir     string
+}
+
+func (lt *LocalTarget) Up() (err error) {
+	if lt.dir != "" {
+		return nil
+	}
+	if lt.dir, err = ioutil.TempDir("", "reqs-target-"); err != nil {
+		return err
+	}
+	bin := filepath.Join(lt.dir, "bin")
+	if err = os.Mkdir(bin, 0755); err != nil {
+		return err
+	}
+	// hard links, fakepm finds its state file beside the path it runs from
+	for _, name := range []string{FakeTool, "pip", "pip3", "npm", "sudo"} {
+		src, dst := filepath.Join(lt.BinDir, FakeTool), filepath.Join(bin, name)
+		if os.Link(src, dst) != nil {
+			if err = copyFile(src, dst); err != nil {
+				return err
+			}
+		}
+	}
+	return copySources(lt.Sources, filepath.Join(lt.dir, "work"))
+}
+
+// the fakepm state file recording what reqs installed
+func (lt *LocalTarget) State() string {
+	return filepath.Join(lt.dir, "bin", "fakepm.json")
+}
+
+func (lt *LocalTarget) Reqs(args ...string) error {
+	if err := lt.Up(); err != nil {
+		return err
+	}
+	argv := append([]string{filepath.Join(lt.BinDir, "reqs")}, args...)
+	out, err := runnerOrDefault(lt.Runner).Run(context.Background(), Command{
+		Argv: argv,
+		Env: []string{
+			"PATH=" + filepath.Join(lt.dir, "bin"),
+			"HOME=" + lt.dir,
+			"REQS_FAKE_PM=1",
+			"FAKEPM_FLAVOR=" + lt.Config.Tool,
+		},
+		Dir: filepath.Join(lt.dir, "work"),
+	})
+	log.Info(string(out))
+	return err
+}
+
+func (lt *LocalTarget) Down() error {
+	if lt.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(lt.dir)
+	lt.dir = ""
+	return err
+}
+
+// runs reqs in a podman or docker container of Config.Image with copies of
+// Sources as its working directory
+type ContainerTarget struct {
+	Name   string
+	Config TargetConfig
+	// podman or docker, whichever is available when empty
+	Engine string
+	// reqs built for linux, mounted into the container
+	Binary  string
+	Sources []string
+	Runner  Runner
+	dir     string
+}
+
+// the container engine available on this system, podman preferred
+func ContainerEngine(r Runner) string {
+	for _, engine := range []string{"podman", "docker"} {
+		if _, err := runnerOrDefault(r).LookPath(engine); err == nil {
+			return engine
+		}
+	}
+	return ""
+}
+
+func (ct *ContainerTarget) container() string {
+	return "reqs-test-" + ct.Name
+}
+
+func (ct *ContainerTarget) run(argv ...string) error {
+	log.Info(strings.Join(argv, " "))
+	out, err := runnerOrDefault(ct.Runner).Run(context.Background(), Command{Argv: argv})
+	log.Info(string(out))
+	return err
+}
+
+func (ct *ContainerTarget) Up() (err error) {
+	if ct.dir != "" {
+		return nil
+	}
+	if ct.Config.Image == "" {
+		return errors.New("target " + ct.Name + " has no image")
+	}
+	if ct.Engine == "" {
+		ct.Engine = ContainerEngine(ct.Runner)
+	}
+	if ct.Engine == "" {
+		return errors.New("podman or docker is needed for container targets")
+	}
+	if ct.dir, err = ioutil.TempDir("", "reqs-target-"); err != nil {
+		return err
+	}
+	if err = copySources(ct.Sources, ct.dir); err != nil {
+		return err
+	}
+	err = ct.run(ct.Engine, "run", "-d", "--name", ct.container(),
+		"-v", ct.dir+":/work:Z", "-v", ct.Binary+":/usr/local/bin/reqs:ro,Z", "-w", "/work",
+		ct.Config.Image, "sleep", "infinity")
+	if err != nil {
+		return err
+	}
+	for _, setup := range ct.Config.Setup {
+		if err = ct.run(append([]string{ct.Engine, "exec", ct.container()}, setup...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ct *ContainerTarget) Reqs(args ...string) error {
+	if err := ct.Up(); err != nil {
+		return err
+	}
+	return ct.run(append([]string{ct.Engine, "exec", ct.container(), "reqs"}, args...)...)
+}
+
+func (ct *ContainerTarget) Down() error {
+	if ct.dir == "" {
+		return nil
+	}
+	err := ct.run(ct.Engine, "rm", "-f", ct.container())
+	os.RemoveAll(ct.dir)
+	ct.dir = ""
+	return err
+}
+
+// copy each source directory into dst under its own name
+func copySources(sources []string, dst string) error {
+	for _, src := range sources {
+		if err := copyTree(src, filepath.Join(dst, filepath.Base(src))); err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(dst, 0755)
+}
+
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
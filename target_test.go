@@ -0,0 +1,66 @@
+package reqs
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestLocalTarget(t *testing.T) {
+	target := &LocalTarget{
+		Config:  TargetConfig{Tool: "dnf"},
+		BinDir:  buildTargetBinaries(t),
+		Sources: []string{"examples/flask-service"},
+	}
+	defer target.Down()
+	assert.Nil(t, target.Reqs("install", "-d", "flask-service"))
+
+	b, err := ioutil.ReadFile(target.State())
+	assert.Nil(t, err)
+	var state struct {
+		Installed map[string]string
+		Tools     map[string]map[string]string
+	}
+	assert.Nil(t, json.Unmarshal(b, &state))
+	assert.Contains(t, state.Installed, "python-pip")
+	assert.Contains(t, state.Tools["pip"], "flask")
+}
+
+func TestContainerTarget(t *testing.T) {
+	fake := NewFakeRunner()
+	target := &ContainerTarget{
+		Name:    "fedora",
+		Config:  TargetConfig{Image: "fedora:28", Setup: [][]string{{"dnf", "install", "-y", "sudo"}}},
+		Engine:  "podman",
+		Binary:  "/tmp/reqs",
+		Runner:  fake,
+		Sources: []string{"examples/pip3-setup"},
+	}
+	assert.Nil(t, target.Reqs("install", "-r"))
+	assert.Nil(t, target.Reqs("check"))
+	dir := target.dir
+	assert.Nil(t, target.Down())
+	assert.Equal(t, []string{
+		"podman run -d --name reqs-test-fedora -v " + dir + ":/work:Z -v /tmp/reqs:/usr/local/bin/reqs:ro,Z -w /work fedora:28 sleep infinity",
+		"podman exec reqs-test-fedora dnf install -y sudo",
+		"podman exec reqs-test-fedora reqs install -r",
+		"podman exec reqs-test-fedora reqs check",
+		"podman rm -f reqs-test-fedora",
+	}, fake.CommandLines())
+}
+
+func TestVagrantTarget(t *testing.T) {
+	fake := NewFakeRunner()
+	target := &VagrantTarget{Machine: "ubuntu", Runner: fake}
+	assert.Nil(t, target.Reqs("install", "-d", "it's"))
+	assert.Nil(t, target.Reqs("check"))
+	assert.Nil(t, target.Down())
+	// the machine is brought up once
+	assert.Equal(t, []string{
+		"vagrant up ubuntu",
+		`vagrant ssh ubuntu -c 'reqs' 'install' '-d' 'it'\''s'`,
+		"vagrant ssh ubuntu -c 'reqs' 'check'",
+		"vagrant destroy ubuntu -f",
+	}, fake.CommandLines())
+}
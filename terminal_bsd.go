@@ -0,0 +1,8 @@
+//go:build darwin || freebsd || netbsd || openbsd
+// +build darwin freebsd netbsd openbsd
+
+package reqs
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TIOCGETA
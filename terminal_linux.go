@@ -0,0 +1,5 @@
+package reqs
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TCGETS
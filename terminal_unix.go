@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package reqs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// whether f is a terminal rather than a file, pipe or /dev/null, which
+// only a terminal answers reading its termios
+func IsTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlReadTermios, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
@@ -3,25 +3,23 @@ package reqs
 import (
 	log "github.com/sirupsen/logrus"
 	"os"
-	"os/exec"
 	"strings"
 )
 
+// log err and exit, interruptions exit with the status of their cause
 func FatalCheck(err error) {
+	if ie, ok := err.(*InterruptedError); ok {
+		log.Error(ie)
+		os.Exit(ie.ExitCode())
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
 func IsCommandAvailable(name string) bool {
-	cmd := exec.Command("/bin/sh", "-c", "command -v "+name)
-	cmd.Env = []string{
-		"PATH=" + os.ExpandEnv("$PATH"),
-	}
-	if err := cmd.Run(); err != nil {
-		return false
-	}
-	return true
+	_, err := DefaultRunner.LookPath(name)
+	return err == nil
 }
 
 func NewLineIfNotEmpty(text, newText string) string {
@@ -42,6 +40,14 @@ func StringInSlice(a string, list []string) bool {
 	return false
 }
 
+// append s to list unless it is already present
+func appendUnique(list []string, s string) []string {
+	if StringInSlice(s, list) {
+		return list
+	}
+	return append(list, s)
+}
+
 func StringContainedInSlice(s string, arr []string) bool {
 	for _, v := range arr {
 		if strings.Contains(s, v) {
@@ -1,84 +1,47 @@
 package reqs
 
 import (
-	"bufio"
+	"context"
 	log "github.com/sirupsen/logrus"
-	"os/exec"
+	"strings"
 )
 
-type VagrantSystem struct {
-	Arch, Status string
+// runs reqs on a machine from the Vagrantfile, provisioned with the
+// examples and a released reqs
+type VagrantTarget struct {
+	Machine string
+	Runner  Runner
+	up      bool
 }
 
-func (vm VagrantSystem) Up() {
-	cmdStr := "vagrant up " + vm.Arch
-	log.Info(cmdStr)
-	cmd := exec.Command("/bin/sh", "-c", cmdStr)
-	cmdReader, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	scanner := bufio.NewScanner(cmdReader)
-	go func() {
-		for scanner.Scan() {
-			log.Info(scanner.Text())
-		}
-	}()
-
-	err = cmd.Start()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = cmd.Wait()
-	if err != nil {
-		log.Fatal(err)
-	}
-	vm.Status = "up"
-}
-
-func (vm VagrantSystem) Down() {
-	cmdStr := "vagrant destroy " + vm.Arch + " -f"
-	log.Info(cmdStr)
-	out, err := exec.Command("/bin/sh", "-c", cmdStr).Output()
-	if err != nil {
-		log.Fatal(err)
-	}
+func (vt *VagrantTarget) run(argv ...string) error {
+	log.Info(strings.Join(argv, " "))
+	out, err := runnerOrDefault(vt.Runner).Run(context.Background(), Command{Argv: argv})
 	log.Info(string(out))
-	vm.Status = "down"
+	return err
 }
 
-func (vm VagrantSystem) Run(cmdStr string) error {
-	if vm.Status != "up" {
-		vm.Up()
+func (vt *VagrantTarget) Up() error {
+	if vt.up {
+		return nil
 	}
-	cmdStr = "vagrant ssh " + vm.Arch + " -c \"" + cmdStr + "\""
-	log.Info(cmdStr)
-	cmd := exec.Command("/bin/sh", "-c", cmdStr)
-	cmdReader, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatal(err)
+	if err := vt.run("vagrant", "up", vt.Machine); err != nil {
 		return err
 	}
+	vt.up = true
+	return nil
+}
 
-	scanner := bufio.NewScanner(cmdReader)
-	go func() {
-		for scanner.Scan() {
-			log.Info(scanner.Text())
-		}
-	}()
-
-	err = cmd.Start()
-	if err != nil {
-		log.Fatal(err)
+// vagrant ssh only takes a command string so each argument is quoted
+// for the remote shell
+func (vt *VagrantTarget) Reqs(args ...string) error {
+	if err := vt.Up(); err != nil {
 		return err
 	}
+	return vt.run("vagrant", "ssh", vt.Machine, "-c", shellQuote(append([]string{"reqs"}, args...)))
+}
 
-	err = cmd.Wait()
-	if err != nil {
-		log.Fatal(err)
-		return err
-	}
-	return err
+func (vt *VagrantTarget) Down() error {
+	vt.up = false
+	return vt.run("vagrant", "destroy", vt.Machine, "-f")
 }
@@ -0,0 +1,184 @@
+package reqs
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// package names come from whatever repository reqs runs in, so they are
+// checked against what each tool accepts before any of them reach a command
+
+// characters a shell would interpret, never part of a package name
+const shellMetacharacters = ";&|$`\\\"'(){}\n\r\t "
+
+// glob and redirection characters, refused for tools without a pattern
+// of their own, the patterns decide where a tool's versions allow them
+const globMetacharacters = "<>*?!#~[]"
+
+var packageNamePatterns = map[string]*regexp.Regexp{
+	// name, optional :arch and =version or /release
+	"apt": regexp.MustCompile(`^[a-z0-9][a-z0-9+.\-]*(:[a-z0-9\-]+)?([=/][A-Za-z0-9.+:~\-]+)?$`),
+	// name or name-version-release, optional .arch
+	"dnf": regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+:\-]*$`),
+	"yum": regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+:\-]*$`),
+	// formula, formula@version or user/repo/formula
+	"brew": regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._+\-]*(/[A-Za-z0-9@._+\-]+){0,2}$`),
+	// name, optional extras and comma separated version specifiers
+	"pip": regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._\-]*(\[[A-Za-z0-9,._\-]+\])?((===|==|>=|<=|~=|!=|<|>)[A-Za-z0-9.*+!_\-]+)?(,(===|==|>=|<=|~=|!=|<|>)[A-Za-z0-9.*+!_\-]+)*$`),
+	// optionally scoped name and @version
+	"npm": regexp.MustCompile(`^(@[A-Za-z0-9][A-Za-z0-9._~\-]*/)?[A-Za-z0-9][A-Za-z0-9._~\-]*(@[A-Za-z0-9.^~*+\-]+)?$`),
+}
+
+// check a single package entry for tool, entries starting with - would be
+// read as options and shell metacharacters are rejected outright
+func ValidatePackageName(tool, name string) error {
+	if name == "" {
+		return errors.New("empty package name")
+	}
+	if i := strings.IndexAny(name, shellMetacharacters); i != -1 {
+		return errors.New("package name " + quoteEntry(name) + " contains shell metacharacter " + quoteEntry(name[i:i+1]))
+	}
+	if strings.HasPrefix(name, "-") {
+		return errors.New("package name " + quoteEntry(name) + " starts with - and would be read as an option")
+	}
+	pattern, ok := packageNamePatterns[emulatedTool(tool)]
+	if tool == "pip3" {
+		pattern, ok = packageNamePatterns["pip"]
+	}
+	if !ok {
+		if i := strings.IndexAny(name, globMetacharacters); i != -1 {
+			return errors.New("package name " + quoteEntry(name) + " contains glob character " + quoteEntry(name[i:i+1]))
+		}
+		return nil
+	}
+	if !pattern.MatchString(name) {
+		return errors.New("invalid " + tool + " package name " + quoteEntry(name))
+	}
+	return nil
+}
+
+// check every package in a space separated list for tool
+func ValidatePackageList(tool, list string) error {
+	var problems []string
+	for _, name := range strings.Fields(list) {
+		if err := ValidatePackageName(tool, name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("refusing to run " + tool + ": " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// options pip reads from a requirements file, and whether they take a value,
+// any other option is refused since several of them run build commands
+var pipFileOptions = map[string]bool{
+	"-r":                true,
+	"--requirement":     true,
+	"-c":                true,
+	"--constraint":      true,
+	"-e":                true,
+	"--editable":        true,
+	"-i":                true,
+	"--index-url":       true,
+	"--extra-index-url": true,
+	"-f":                true,
+	"--find-links":      true,
+	"--only-binary":     true,
+	"--no-binary":       true,
+	"--no-index":        false,
+	"--pre":             false,
+	"--prefer-binary":   false,
+	"--require-hashes":  false,
+}
+
+// urls pip may fetch from, plain http, file and other vcs urls are refused
+var pipURLPattern = regexp.MustCompile(`^(https|git\+https|git\+ssh)://[^\s]+$`)
+
+// check a line of pip requirements as pip reads it from a file, options
+// must be ones pip accepts in requirements files and urls must be https
+// or git over https or ssh, anything else is a local path or a requirement
+// with optional extras, versions, environment marker and hashes
+func ValidatePipLine(line string) error {
+	if i := strings.Index(line, " #"); i != -1 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	if strings.HasPrefix(line, "-") {
+		opt, value := splitPipOption(line)
+		takesValue, ok := pipFileOptions[opt]
+		switch {
+		case !ok:
+			return errors.New("pip option " + quoteEntry(opt) + " is not allowed in requirements")
+		case takesValue && value == "":
+			return errors.New("pip option " + quoteEntry(opt) + " needs a value")
+		case !takesValue && value != "":
+			return errors.New("pip option " + quoteEntry(opt) + " takes no value")
+		case strings.Contains(value, "://"):
+			return validatePipURL(value)
+		}
+		return nil
+	}
+	// hashes are the only options pip takes after a requirement
+	if i := strings.Index(line, " --"); i != -1 {
+		for _, opt := range strings.Fields(line[i:]) {
+			if !strings.HasPrefix(opt, "--hash=") {
+				return errors.New("pip option " + quoteEntry(opt) + " is not allowed after a requirement")
+			}
+		}
+		line = line[:i]
+	}
+	if strings.Contains(line, "://") {
+		url := line
+		if i := strings.Index(url, "; "); i != -1 {
+			url = url[:i]
+		}
+		// name @ url, or a url naming the package with #egg=
+		if i := strings.Index(url, "@"); i != -1 && i < strings.Index(url, "://") {
+			name := strings.TrimSpace(url[:i])
+			if err := ValidatePackageName("pip", strings.Replace(name, " ", "", -1)); err != nil {
+				return err
+			}
+			url = strings.TrimSpace(url[i+1:])
+		}
+		return validatePipURL(url)
+	}
+	if i := strings.Index(line, ";"); i != -1 {
+		line = line[:i]
+	}
+	if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "/") {
+		// a local project directory or archive
+		return nil
+	}
+	return ValidatePackageName("pip", strings.Replace(line, " ", "", -1))
+}
+
+func validatePipURL(url string) error {
+	if !pipURLPattern.MatchString(url) {
+		return errors.New("pip url " + quoteEntry(url) + " is not https, git+https or git+ssh")
+	}
+	return nil
+}
+
+// check every line of pip requirements text as PipInstall writes it out
+func ValidatePipRequirements(tool, text string) error {
+	var problems []string
+	for _, line := range strings.Split(text, "\n") {
+		if err := ValidatePipLine(line); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("refusing to run " + tool + ": " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+func quoteEntry(s string) string {
+	return "'" + strings.Replace(s, "\n", "\\n", -1) + "'"
+}
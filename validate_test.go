@@ -0,0 +1,92 @@
+package reqs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidatePackageName(t *testing.T) {
+	valid := map[string][]string{
+		"apt":  {"git", "libssl1.0.0", "g++", "python3-pip", "nginx=1.14.0-0ubuntu1", "libc6:i386", "libssl1.1=1.1.1f-1ubuntu2~20.04"},
+		"dnf":  {"git", "python2-pip", "kernel-devel-4.18.0", "glibc.i686"},
+		"brew": {"git", "python@2", "homebrew/cask/firefox"},
+		"pip":  {"flask", "flask==1.0.2", "requests[security]>=2.0,<3", "zope.interface"},
+		"npm":  {"express", "express@4.16.0", "@angular/cli", "@types/node@^10.0.0", "lodash@~4.17.0", "lodash@4.x", "left-pad@*"},
+	}
+	for tool, names := range valid {
+		for _, name := range names {
+			assert.Nil(t, ValidatePackageName(tool, name), tool+" "+name)
+		}
+	}
+
+	invalid := map[string][]string{
+		"apt":  {"git;rm", "$(reboot)", "-oDebug", "git*", "Git", "git~", ">out"},
+		"dnf":  {"git`id`", "--setopt=x"},
+		"brew": {"git&&id", "a/b/c/d"},
+		"pip":  {"flask; python_version<'3'", "-r other.txt", "https://example.com/pkg.tgz"},
+		"npm":  {"express|id", "git+https://example.com/x.git", "a b", "lodash*", "~lodash"},
+	}
+	for tool, names := range invalid {
+		for _, name := range names {
+			assert.NotNil(t, ValidatePackageName(tool, name), tool+" "+name)
+		}
+	}
+}
+
+func TestValidatePackageList(t *testing.T) {
+	assert.Nil(t, ValidatePackageList("apt", "git curl"))
+	err := ValidatePackageList("apt", "git curl;id")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "curl;id")
+}
+
+func TestValidatePackageNameUnknownTool(t *testing.T) {
+	assert.Nil(t, ValidatePackageName("gem", "rails"))
+	assert.EqualError(t, ValidatePackageName("gem", "rails*"), "package name 'rails*' contains glob character '*'")
+}
+
+func TestValidatePipLine(t *testing.T) {
+	valid := []string{
+		"flask",
+		"requests[security] >= 2.0, < 3",
+		`pywin32; "win32" == sys_platform`,
+		"flask==1.0.2 --hash=sha256:abc --hash=sha256:def",
+		"flask  # the web framework",
+		"-r base.txt",
+		"--requirement=base.txt",
+		"-c constraints.txt",
+		"-e .",
+		"-e git+https://github.com/pallets/flask.git#egg=flask",
+		"-i https://pypi.example.com/simple",
+		"--no-index",
+		"--only-binary :all:",
+		"./vendor/pkg",
+		"https://example.com/pkg.tar.gz#egg=pkg",
+		"pkg @ git+ssh://git@github.com/org/pkg.git",
+	}
+	for _, line := range valid {
+		assert.Nil(t, ValidatePipLine(line), line)
+	}
+
+	invalid := []string{
+		"--global-option build_ext",
+		"--install-option=--prefix=/x",
+		"flask --install-option=--prefix=/x",
+		"-r",
+		"--pre yes",
+		"-i http://pypi.example.com/simple",
+		"-e file:///tmp/pkg",
+		"http://example.com/pkg.tar.gz#egg=pkg",
+		"pkg @ svn+http://example.com/pkg",
+		"flask;id @ https://example.com/pkg.tar.gz",
+	}
+	for _, line := range invalid {
+		assert.NotNil(t, ValidatePipLine(line), line)
+	}
+}
+
+func TestValidatePipRequirements(t *testing.T) {
+	assert.Nil(t, ValidatePipRequirements("pip", "-r base.txt\nflask==1.0.2"))
+	assert.EqualError(t, ValidatePipRequirements("pip", "flask\n--global-option build_ext"),
+		"refusing to run pip: pip option '--global-option' is not allowed in requirements")
+}